@@ -396,10 +396,37 @@ type (
 		Rparen   token.Pos // position of ")"
 	}
 
-	// A TryExpr node represents an expression followed by the `?` operator.
+	// A TryExpr node represents an expression followed by the `?` operator,
+	// optionally followed by a parenthesized error wrap message, or by the
+	// name of the error and a block handling it. With `?continue` and
+	// `?break`, the error continues or breaks out of a loop instead, after
+	// the optional handler.
 	TryExpr struct {
-		X        Expr      // expression
-		Question token.Pos // position of "?"
+		X         Expr        // expression
+		Question  token.Pos   // position of "?"
+		Lparen    token.Pos   // position of "(" of the wrap message; or token.NoPos
+		Args      []Expr      // wrap message format and arguments; or nil
+		Rparen    token.Pos   // position of ")" of the wrap message; or token.NoPos
+		BranchPos token.Pos   // position of "continue" or "break"; or token.NoPos
+		Branch    token.Token // token.CONTINUE or token.BREAK; or token.ILLEGAL
+		Label     *Ident      // label of the loop; or nil
+		Err       *Ident      // name of the error in the handler; or nil
+		Handler   *BlockStmt  // error handler; or nil
+	}
+
+	// A DefaultExpr node represents an expression followed by the `??`
+	// operator and the value used instead of it when its error is not nil.
+	DefaultExpr struct {
+		X     Expr      // expression
+		OpPos token.Pos // position of "??"
+		Y     Expr      // default value
+	}
+
+	// A MustExpr node represents an expression followed by the postfix `!`
+	// operator, which panics with a non-nil error.
+	MustExpr struct {
+		X    Expr      // expression
+		Bang token.Pos // position of "!"
 	}
 
 	// A StarExpr node represents an expression of the form "*" Expression.
@@ -518,6 +545,8 @@ func (x *SliceExpr) Pos() token.Pos      { return x.X.Pos() }
 func (x *TypeAssertExpr) Pos() token.Pos { return x.X.Pos() }
 func (x *CallExpr) Pos() token.Pos       { return x.Fun.Pos() }
 func (x *TryExpr) Pos() token.Pos        { return x.X.Pos() }
+func (x *DefaultExpr) Pos() token.Pos    { return x.X.Pos() }
+func (x *MustExpr) Pos() token.Pos       { return x.X.Pos() }
 func (x *StarExpr) Pos() token.Pos       { return x.Star }
 func (x *UnaryExpr) Pos() token.Pos      { return x.OpPos }
 func (x *BinaryExpr) Pos() token.Pos     { return x.X.Pos() }
@@ -552,13 +581,29 @@ func (x *IndexListExpr) End() token.Pos  { return x.Rbrack + 1 }
 func (x *SliceExpr) End() token.Pos      { return x.Rbrack + 1 }
 func (x *TypeAssertExpr) End() token.Pos { return x.Rparen + 1 }
 func (x *CallExpr) End() token.Pos       { return x.Rparen + 1 }
-func (x *TryExpr) End() token.Pos        { return x.Question + 1 }
-func (x *StarExpr) End() token.Pos       { return x.X.End() }
-func (x *UnaryExpr) End() token.Pos      { return x.X.End() }
-func (x *BinaryExpr) End() token.Pos     { return x.Y.End() }
-func (x *KeyValueExpr) End() token.Pos   { return x.Value.End() }
-func (x *ArrayType) End() token.Pos      { return x.Elt.End() }
-func (x *StructType) End() token.Pos     { return x.Fields.End() }
+func (x *TryExpr) End() token.Pos {
+	if x.Handler != nil {
+		return x.Handler.End()
+	}
+	if x.Rparen.IsValid() {
+		return x.Rparen + 1
+	}
+	if x.Label != nil {
+		return x.Label.End()
+	}
+	if x.BranchPos.IsValid() {
+		return token.Pos(int(x.BranchPos) + len(x.Branch.String()))
+	}
+	return x.Question + 1
+}
+func (x *DefaultExpr) End() token.Pos  { return x.Y.End() }
+func (x *MustExpr) End() token.Pos     { return x.Bang + 1 }
+func (x *StarExpr) End() token.Pos     { return x.X.End() }
+func (x *UnaryExpr) End() token.Pos    { return x.X.End() }
+func (x *BinaryExpr) End() token.Pos   { return x.Y.End() }
+func (x *KeyValueExpr) End() token.Pos { return x.Value.End() }
+func (x *ArrayType) End() token.Pos    { return x.Elt.End() }
+func (x *StructType) End() token.Pos   { return x.Fields.End() }
 func (x *FuncType) End() token.Pos {
 	if x.Results != nil {
 		return x.Results.End()
@@ -585,6 +630,8 @@ func (*SliceExpr) exprNode()      {}
 func (*TypeAssertExpr) exprNode() {}
 func (*CallExpr) exprNode()       {}
 func (*TryExpr) exprNode()        {}
+func (*DefaultExpr) exprNode()    {}
+func (*MustExpr) exprNode()       {}
 func (*StarExpr) exprNode()       {}
 func (*UnaryExpr) exprNode()      {}
 func (*BinaryExpr) exprNode()     {}
@@ -689,10 +736,21 @@ type (
 		Call *CallExpr
 	}
 
-	// A DeferStmt node represents a defer statement.
+	// A DeferStmt node represents a defer statement. A `defer?` statement
+	// joins the error of the deferred call into the error result of the
+	// function.
 	DeferStmt struct {
-		Defer token.Pos // position of "defer" keyword
-		Call  *CallExpr
+		Defer    token.Pos // position of "defer" keyword
+		Question token.Pos // position of "?" of `defer?`; or token.NoPos
+		Call     *CallExpr
+	}
+
+	// A HandleStmt node represents an error handler declaration, which
+	// handles the errors of the try expressions following it in its block.
+	HandleStmt struct {
+		Handle token.Pos  // position of "handle"
+		Err    *Ident     // name of the error
+		Body   *BlockStmt // handler body
 	}
 
 	// A ReturnStmt node represents a return statement.
@@ -797,6 +855,7 @@ func (s *IncDecStmt) Pos() token.Pos     { return s.X.Pos() }
 func (s *AssignStmt) Pos() token.Pos     { return s.Lhs[0].Pos() }
 func (s *GoStmt) Pos() token.Pos         { return s.Go }
 func (s *DeferStmt) Pos() token.Pos      { return s.Defer }
+func (s *HandleStmt) Pos() token.Pos     { return s.Handle }
 func (s *ReturnStmt) Pos() token.Pos     { return s.Return }
 func (s *BranchStmt) Pos() token.Pos     { return s.TokPos }
 func (s *BlockStmt) Pos() token.Pos      { return s.Lbrace }
@@ -826,6 +885,7 @@ func (s *IncDecStmt) End() token.Pos {
 func (s *AssignStmt) End() token.Pos { return s.Rhs[len(s.Rhs)-1].End() }
 func (s *GoStmt) End() token.Pos     { return s.Call.End() }
 func (s *DeferStmt) End() token.Pos  { return s.Call.End() }
+func (s *HandleStmt) End() token.Pos { return s.Body.End() }
 func (s *ReturnStmt) End() token.Pos {
 	if n := len(s.Results); n > 0 {
 		return s.Results[n-1].End()
@@ -883,6 +943,7 @@ func (*IncDecStmt) stmtNode()     {}
 func (*AssignStmt) stmtNode()     {}
 func (*GoStmt) stmtNode()         {}
 func (*DeferStmt) stmtNode()      {}
+func (*HandleStmt) stmtNode()     {}
 func (*ReturnStmt) stmtNode()     {}
 func (*BranchStmt) stmtNode()     {}
 func (*BlockStmt) stmtNode()      {}
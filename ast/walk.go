@@ -122,6 +122,23 @@ func Walk(v Visitor, node Node) {
 
 	case *TryExpr:
 		Walk(v, n.X)
+		walkList(v, n.Args)
+		if n.Label != nil {
+			Walk(v, n.Label)
+		}
+		if n.Err != nil {
+			Walk(v, n.Err)
+		}
+		if n.Handler != nil {
+			Walk(v, n.Handler)
+		}
+
+	case *DefaultExpr:
+		Walk(v, n.X)
+		Walk(v, n.Y)
+
+	case *MustExpr:
+		Walk(v, n.X)
 
 	case *StarExpr:
 		Walk(v, n.X)
@@ -202,6 +219,10 @@ func Walk(v Visitor, node Node) {
 	case *DeferStmt:
 		Walk(v, n.Call)
 
+	case *HandleStmt:
+		Walk(v, n.Err)
+		Walk(v, n.Body)
+
 	case *ReturnStmt:
 		walkList(v, n.Results)
 
@@ -0,0 +1,623 @@
+// Package astconv converts syntax trees between the ast package of ego and
+// the go/ast package of the standard library, so that tools for Go source
+// can operate on .ego sources.
+//
+// The ast package of ego is a fork of go/ast, and nodes convert to the
+// nodes of the same name, along with their comments and their resolved
+// objects. Try, must and default expressions, which Go lacks, are
+// represented in Go as calls of the functions named TryFunc, MustFunc and
+// DefaultFunc, handle statements as calls of HandleFunc, and `defer?`
+// statements as deferred calls of DeferFunc:
+//
+//	x?                  __ego_try(x)
+//	x?("msg", args...)  __ego_try(x, __ego_wrap("msg", args...))
+//	x? err { ... }      __ego_try(x, __ego_handle(err, func() { ... }))
+//	x?continue L        __ego_try(x, __ego_continue(L))
+//	x?break e { ... }   __ego_try(x, __ego_break(__ego_handle(e, func() { ... })))
+//	x!                  __ego_must(x)
+//	x ?? y              __ego_default(x, y)
+//	handle err { ... }  __ego_handle(err, func() { ... })
+//	defer? f()          defer __ego_defer(f())
+//
+// Positions are kept as they are, so that nodes converted with files of a
+// file set refer to the same source in the file set converted with them.
+package astconv
+
+import (
+	goast "go/ast"
+	gotoken "go/token"
+	"reflect"
+	"strings"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+const (
+	// TryFunc is the name of the function called in place of a try
+	// expression. The position of the name is the position of the operand,
+	// and the parentheses of the call are at the position of "?" and of
+	// the end of the try expression.
+	TryFunc = "__ego_try"
+	// WrapFunc is the name of the function called with the wrap message of
+	// a try expression, as the last argument of TryFunc. The position of
+	// the name is the position of "?".
+	WrapFunc = "__ego_wrap"
+	// HandleFunc is the name of the function called with the error name
+	// and the handler of a try expression, as a function literal, as the
+	// last argument of TryFunc. The position of the name is the position
+	// of "?", and the literal is at the position of the handler. Handle
+	// statements are calls of HandleFunc named at the position of
+	// "handle".
+	HandleFunc = "__ego_handle"
+	// ContinueFunc and BreakFunc are the names of the functions called
+	// with the optional label and handler of `?continue` and `?break`, as
+	// the last argument of TryFunc. The position of the names is the
+	// position of the keyword.
+	ContinueFunc = "__ego_continue"
+	BreakFunc    = "__ego_break"
+	// MustFunc is the name of the function called in place of a must
+	// expression. The position of the name is the position of the operand,
+	// and both parentheses of the call are at the position of "!".
+	MustFunc = "__ego_must"
+	// DefaultFunc is the name of the function called in place of a default
+	// expression. The position of the name is the position of the operand,
+	// the left parenthesis is at the position of "??" and the right one at
+	// the end of the default value.
+	DefaultFunc = "__ego_default"
+	// DeferFunc is the name of the function deferred in place of the call
+	// of a `defer?` statement, with the call as its argument. The position
+	// of the name and of the left parenthesis is the position of "?", and
+	// the right parenthesis is at the end of the call.
+	DeferFunc = "__ego_defer"
+)
+
+// ToGo converts the node n to go/ast. The resulting node shares no memory
+// with n.
+func ToGo(n ast.Node) goast.Node {
+	if n == nil {
+		return nil
+	}
+	c := newConverter(true)
+	return c.node(reflect.ValueOf(n)).Interface().(goast.Node)
+}
+
+// FromGo converts the node n of go/ast to the ast package of ego. Calls of
+// TryFunc, MustFunc and DefaultFunc become try, must and default
+// expressions.
+func FromGo(n goast.Node) ast.Node {
+	if n == nil {
+		return nil
+	}
+	c := newConverter(false)
+	return c.node(reflect.ValueOf(n)).Interface().(ast.Node)
+}
+
+// ToGoFileSet returns a go/token file set with the files of fset at the
+// same bases and with the same lines, so that positions of nodes converted
+// with ToGo refer to the same source in it. Files added to the returned
+// file set later follow the files of fset.
+func ToGoFileSet(fset *token.FileSet) *gotoken.FileSet {
+	goFset := gotoken.NewFileSet()
+	fset.Iterate(func(f *token.File) bool {
+		goFile := goFset.AddFile(f.Name(), f.Base(), f.Size())
+		goFile.SetLines(f.Lines())
+		return true
+	})
+	return goFset
+}
+
+// FromGoFileSet is the inverse of ToGoFileSet.
+func FromGoFileSet(goFset *gotoken.FileSet) *token.FileSet {
+	fset := token.NewFileSet()
+	goFset.Iterate(func(f *gotoken.File) bool {
+		file := fset.AddFile(f.Name(), f.Base(), f.Size())
+		file.SetLines(f.Lines())
+		return true
+	})
+	return fset
+}
+
+// converter converts the nodes of one syntax tree, which may share objects
+// and scopes, and refer to each other through them.
+type converter struct {
+	toGo bool
+	// Types to convert struct types to.
+	types map[reflect.Type]reflect.Type
+	// Pointers converted so far, and their conversions.
+	seen map[any]reflect.Value
+}
+
+var (
+	// Struct types of ego's ast package along with those of go/ast.
+	egoTypes, goTypes = pairTypes(
+		[2]any{ast.Comment{}, goast.Comment{}},
+		[2]any{ast.CommentGroup{}, goast.CommentGroup{}},
+		[2]any{ast.Field{}, goast.Field{}},
+		[2]any{ast.FieldList{}, goast.FieldList{}},
+		[2]any{ast.BadExpr{}, goast.BadExpr{}},
+		[2]any{ast.Ident{}, goast.Ident{}},
+		[2]any{ast.Ellipsis{}, goast.Ellipsis{}},
+		[2]any{ast.BasicLit{}, goast.BasicLit{}},
+		[2]any{ast.FuncLit{}, goast.FuncLit{}},
+		[2]any{ast.CompositeLit{}, goast.CompositeLit{}},
+		[2]any{ast.ParenExpr{}, goast.ParenExpr{}},
+		[2]any{ast.SelectorExpr{}, goast.SelectorExpr{}},
+		[2]any{ast.IndexExpr{}, goast.IndexExpr{}},
+		[2]any{ast.IndexListExpr{}, goast.IndexListExpr{}},
+		[2]any{ast.SliceExpr{}, goast.SliceExpr{}},
+		[2]any{ast.TypeAssertExpr{}, goast.TypeAssertExpr{}},
+		[2]any{ast.CallExpr{}, goast.CallExpr{}},
+		[2]any{ast.StarExpr{}, goast.StarExpr{}},
+		[2]any{ast.UnaryExpr{}, goast.UnaryExpr{}},
+		[2]any{ast.BinaryExpr{}, goast.BinaryExpr{}},
+		[2]any{ast.KeyValueExpr{}, goast.KeyValueExpr{}},
+		[2]any{ast.ArrayType{}, goast.ArrayType{}},
+		[2]any{ast.StructType{}, goast.StructType{}},
+		[2]any{ast.FuncType{}, goast.FuncType{}},
+		[2]any{ast.InterfaceType{}, goast.InterfaceType{}},
+		[2]any{ast.MapType{}, goast.MapType{}},
+		[2]any{ast.ChanType{}, goast.ChanType{}},
+		[2]any{ast.BadStmt{}, goast.BadStmt{}},
+		[2]any{ast.DeclStmt{}, goast.DeclStmt{}},
+		[2]any{ast.EmptyStmt{}, goast.EmptyStmt{}},
+		[2]any{ast.LabeledStmt{}, goast.LabeledStmt{}},
+		[2]any{ast.ExprStmt{}, goast.ExprStmt{}},
+		[2]any{ast.SendStmt{}, goast.SendStmt{}},
+		[2]any{ast.IncDecStmt{}, goast.IncDecStmt{}},
+		[2]any{ast.AssignStmt{}, goast.AssignStmt{}},
+		[2]any{ast.GoStmt{}, goast.GoStmt{}},
+		[2]any{ast.DeferStmt{}, goast.DeferStmt{}},
+		[2]any{ast.ReturnStmt{}, goast.ReturnStmt{}},
+		[2]any{ast.BranchStmt{}, goast.BranchStmt{}},
+		[2]any{ast.BlockStmt{}, goast.BlockStmt{}},
+		[2]any{ast.IfStmt{}, goast.IfStmt{}},
+		[2]any{ast.CaseClause{}, goast.CaseClause{}},
+		[2]any{ast.SwitchStmt{}, goast.SwitchStmt{}},
+		[2]any{ast.TypeSwitchStmt{}, goast.TypeSwitchStmt{}},
+		[2]any{ast.CommClause{}, goast.CommClause{}},
+		[2]any{ast.SelectStmt{}, goast.SelectStmt{}},
+		[2]any{ast.ForStmt{}, goast.ForStmt{}},
+		[2]any{ast.RangeStmt{}, goast.RangeStmt{}},
+		[2]any{ast.ImportSpec{}, goast.ImportSpec{}},
+		[2]any{ast.ValueSpec{}, goast.ValueSpec{}},
+		[2]any{ast.TypeSpec{}, goast.TypeSpec{}},
+		[2]any{ast.BadDecl{}, goast.BadDecl{}},
+		[2]any{ast.GenDecl{}, goast.GenDecl{}},
+		[2]any{ast.FuncDecl{}, goast.FuncDecl{}},
+		[2]any{ast.File{}, goast.File{}},
+		[2]any{ast.Package{}, goast.Package{}},
+		[2]any{ast.Scope{}, goast.Scope{}},
+		[2]any{ast.Object{}, goast.Object{}},
+	)
+
+	// Tokens of go/token by their string, and the other way around.
+	goTokens, egoTokens = tokensByString()
+
+	tokenType   = reflect.TypeFor[token.Token]()
+	goTokenType = reflect.TypeFor[gotoken.Token]()
+)
+
+// pairTypes maps the types of the first values of pairs to the types of the
+// second ones, and the other way around.
+func pairTypes(pairs ...[2]any) (map[reflect.Type]reflect.Type, map[reflect.Type]reflect.Type) {
+	toGo := make(map[reflect.Type]reflect.Type)
+	fromGo := make(map[reflect.Type]reflect.Type)
+	for _, pair := range pairs {
+		egoType, goType := reflect.TypeOf(pair[0]), reflect.TypeOf(pair[1])
+		toGo[egoType] = goType
+		fromGo[goType] = egoType
+	}
+	return toGo, fromGo
+}
+
+// tokensByString maps the strings of the tokens of go/token and of ego's
+// token package to the tokens. The token packages differ in the tokens ego
+// adds, which shift the values of the tokens following them. Of the tokens
+// with the same string, the first one is kept: NOT rather than the BANG of
+// must expressions, which Go lacks.
+func tokensByString() (map[string]gotoken.Token, map[string]token.Token) {
+	goTokens := make(map[string]gotoken.Token)
+	egoTokens := make(map[string]token.Token)
+	for i := range 256 {
+		if s := gotoken.Token(i).String(); !strings.HasPrefix(s, "token(") {
+			if _, dup := goTokens[s]; !dup {
+				goTokens[s] = gotoken.Token(i)
+			}
+		}
+		if s := token.Token(i).String(); !strings.HasPrefix(s, "token(") {
+			if _, dup := egoTokens[s]; !dup {
+				egoTokens[s] = token.Token(i)
+			}
+		}
+	}
+	return goTokens, egoTokens
+}
+
+func newConverter(toGo bool) *converter {
+	c := &converter{toGo: toGo, types: egoTypes, seen: make(map[any]reflect.Value)}
+	if !toGo {
+		c.types = goTypes
+	}
+	return c
+}
+
+// node converts the pointer to a node, scope or object v, or returns v
+// itself if its type is not converted.
+func (c *converter) node(v reflect.Value) reflect.Value {
+	if v.IsNil() {
+		return v
+	}
+	if conv, ok := c.seen[v.Interface()]; ok {
+		return conv
+	}
+	if c.toGo {
+		switch x := v.Interface().(type) {
+		case *ast.TryExpr:
+			return reflect.ValueOf(c.tryToGo(x))
+		case *ast.MustExpr:
+			return reflect.ValueOf(c.mustToGo(x))
+		case *ast.DefaultExpr:
+			return reflect.ValueOf(c.defaultToGo(x))
+		case *ast.HandleStmt:
+			return reflect.ValueOf(c.handleStmtToGo(x))
+		case *ast.DeferStmt:
+			if x.Question.IsValid() {
+				return reflect.ValueOf(c.deferToGo(x))
+			}
+		}
+	} else if x, ok := v.Interface().(*goast.ExprStmt); ok {
+		if call, ok := x.X.(*goast.CallExpr); ok && isHandleCall(call) {
+			return reflect.ValueOf(c.handleStmtFromGo(x))
+		}
+	} else if x, ok := v.Interface().(*goast.DeferStmt); ok && isDeferCall(x.Call) {
+		return reflect.ValueOf(c.deferFromGo(x))
+	} else if x, ok := v.Interface().(*goast.CallExpr); ok {
+		switch {
+		case isTryCall(x):
+			return reflect.ValueOf(c.tryFromGo(x))
+		case isMustCall(x):
+			return reflect.ValueOf(c.mustFromGo(x))
+		case isDefaultCall(x):
+			return reflect.ValueOf(c.defaultFromGo(x))
+		}
+	}
+
+	typ, ok := c.types[v.Type().Elem()]
+	if !ok {
+		return v
+	}
+	conv := reflect.New(typ)
+	c.seen[v.Interface()] = conv
+	src := v.Elem()
+	for i := range typ.NumField() {
+		field := typ.Field(i)
+		if from := src.FieldByName(field.Name); from.IsValid() {
+			conv.Elem().Field(i).Set(c.value(from, field.Type))
+		}
+	}
+	return conv
+}
+
+// value converts v to a value of type typ.
+func (c *converter) value(v reflect.Value, typ reflect.Type) reflect.Value {
+	switch {
+	case v.Type() == tokenType:
+		return reflect.ValueOf(goTokens[v.Interface().(token.Token).String()])
+	case v.Type() == goTokenType:
+		return reflect.ValueOf(egoTokens[v.Interface().(gotoken.Token).String()])
+	}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return reflect.Zero(typ)
+		}
+		return c.node(v)
+	case reflect.Interface:
+		if v.IsNil() {
+			return reflect.Zero(typ)
+		}
+		conv := reflect.New(typ).Elem()
+		elem := v.Elem()
+		if elem.Kind() == reflect.Pointer {
+			elem = c.node(elem)
+		}
+		conv.Set(elem)
+		return conv
+	case reflect.Slice:
+		if v.IsNil() {
+			return reflect.Zero(typ)
+		}
+		conv := reflect.MakeSlice(typ, v.Len(), v.Len())
+		for i := range v.Len() {
+			conv.Index(i).Set(c.value(v.Index(i), typ.Elem()))
+		}
+		return conv
+	case reflect.Map:
+		if v.IsNil() {
+			return reflect.Zero(typ)
+		}
+		conv := reflect.MakeMapWithSize(typ, v.Len())
+		for iter := v.MapRange(); iter.Next(); {
+			conv.SetMapIndex(iter.Key(), c.value(iter.Value(), typ.Elem()))
+		}
+		return conv
+	}
+	// Positions, strings and other basic values.
+	return v.Convert(typ)
+}
+
+// tryToGo converts the try expression x to a call of TryFunc.
+func (c *converter) tryToGo(x *ast.TryExpr) *goast.CallExpr {
+	call := &goast.CallExpr{
+		Fun:    &goast.Ident{NamePos: gotoken.Pos(x.Pos()), Name: TryFunc},
+		Lparen: gotoken.Pos(x.Question),
+		Rparen: gotoken.Pos(x.End() - 1),
+	}
+	c.seen[x] = reflect.ValueOf(call)
+	call.Args = []goast.Expr{c.goExpr(x.X)}
+	if x.Lparen.IsValid() {
+		wrap := &goast.CallExpr{
+			Fun:    &goast.Ident{NamePos: gotoken.Pos(x.Question), Name: WrapFunc},
+			Lparen: gotoken.Pos(x.Lparen),
+			Rparen: gotoken.Pos(x.Rparen),
+		}
+		for _, arg := range x.Args {
+			wrap.Args = append(wrap.Args, c.goExpr(arg))
+		}
+		call.Args = append(call.Args, wrap)
+	}
+	switch {
+	case x.BranchPos.IsValid():
+		name := ContinueFunc
+		if x.Branch == token.BREAK {
+			name = BreakFunc
+		}
+		branch := &goast.CallExpr{
+			Fun:    &goast.Ident{NamePos: gotoken.Pos(x.BranchPos), Name: name},
+			Lparen: gotoken.Pos(x.BranchPos),
+			Rparen: gotoken.Pos(x.End() - 1),
+		}
+		if x.Label != nil {
+			branch.Args = append(branch.Args, c.goExpr(x.Label))
+		}
+		if x.Handler != nil {
+			branch.Args = append(branch.Args, c.handleToGo(x.BranchPos, x.Err, x.Handler))
+		}
+		call.Args = append(call.Args, branch)
+	case x.Handler != nil:
+		call.Args = append(call.Args, c.handleToGo(x.Question, x.Err, x.Handler))
+	}
+	return call
+}
+
+// handleToGo converts the handler body receiving the error err to a call
+// of HandleFunc named at pos.
+func (c *converter) handleToGo(pos token.Pos, err *ast.Ident, body *ast.BlockStmt) *goast.CallExpr {
+	lbrace := gotoken.Pos(body.Lbrace)
+	return &goast.CallExpr{
+		Fun:    &goast.Ident{NamePos: gotoken.Pos(pos), Name: HandleFunc},
+		Lparen: gotoken.Pos(err.Pos()),
+		Args: []goast.Expr{
+			c.goExpr(err),
+			&goast.FuncLit{
+				Type: &goast.FuncType{Func: lbrace, Params: &goast.FieldList{Opening: lbrace, Closing: lbrace}},
+				Body: c.node(reflect.ValueOf(body)).Interface().(*goast.BlockStmt),
+			},
+		},
+		Rparen: gotoken.Pos(body.Rbrace),
+	}
+}
+
+// handleStmtToGo converts the handle statement s to a statement calling
+// HandleFunc.
+func (c *converter) handleStmtToGo(s *ast.HandleStmt) *goast.ExprStmt {
+	stmt := &goast.ExprStmt{}
+	c.seen[s] = reflect.ValueOf(stmt)
+	stmt.X = c.handleToGo(s.Handle, s.Err, s.Body)
+	return stmt
+}
+
+// handleStmtFromGo converts the statement stmt calling HandleFunc to a
+// handle statement.
+func (c *converter) handleStmtFromGo(stmt *goast.ExprStmt) *ast.HandleStmt {
+	call := stmt.X.(*goast.CallExpr)
+	s := &ast.HandleStmt{Handle: token.Pos(call.Fun.Pos())}
+	c.seen[stmt] = reflect.ValueOf(s)
+	s.Err = c.egoExpr(call.Args[0]).(*ast.Ident)
+	s.Body = c.node(reflect.ValueOf(call.Args[1].(*goast.FuncLit).Body)).Interface().(*ast.BlockStmt)
+	return s
+}
+
+// deferToGo converts the `defer?` statement s to a defer statement
+// deferring a call of DeferFunc.
+func (c *converter) deferToGo(s *ast.DeferStmt) *goast.DeferStmt {
+	stmt := &goast.DeferStmt{Defer: gotoken.Pos(s.Defer)}
+	c.seen[s] = reflect.ValueOf(stmt)
+	stmt.Call = &goast.CallExpr{
+		Fun:    &goast.Ident{NamePos: gotoken.Pos(s.Question), Name: DeferFunc},
+		Lparen: gotoken.Pos(s.Question),
+		Args:   []goast.Expr{c.goExpr(s.Call)},
+		Rparen: gotoken.Pos(s.Call.End() - 1),
+	}
+	return stmt
+}
+
+// deferFromGo converts the defer statement stmt deferring a call of
+// DeferFunc to a `defer?` statement.
+func (c *converter) deferFromGo(stmt *goast.DeferStmt) *ast.DeferStmt {
+	s := &ast.DeferStmt{Defer: token.Pos(stmt.Defer), Question: token.Pos(stmt.Call.Lparen)}
+	c.seen[stmt] = reflect.ValueOf(s)
+	s.Call = c.egoExpr(stmt.Call.Args[0]).(*ast.CallExpr)
+	return s
+}
+
+// isDeferCall reports whether call is a call of DeferFunc converted from a
+// `defer?` statement.
+func isDeferCall(call *goast.CallExpr) bool {
+	ident, ok := call.Fun.(*goast.Ident)
+	if !ok || ident.Name != DeferFunc || len(call.Args) != 1 || call.Ellipsis.IsValid() {
+		return false
+	}
+	_, ok = call.Args[0].(*goast.CallExpr)
+	return ok
+}
+
+// tryFromGo converts the call of TryFunc call to a try expression.
+func (c *converter) tryFromGo(call *goast.CallExpr) *ast.TryExpr {
+	x := &ast.TryExpr{Question: token.Pos(call.Lparen)}
+	c.seen[call] = reflect.ValueOf(x)
+	x.X = c.egoExpr(call.Args[0])
+	if len(call.Args) == 2 {
+		wrap := call.Args[1].(*goast.CallExpr)
+		if isBranchCall(wrap) {
+			x.BranchPos = token.Pos(wrap.Fun.Pos())
+			x.Branch = token.CONTINUE
+			if wrap.Fun.(*goast.Ident).Name == BreakFunc {
+				x.Branch = token.BREAK
+			}
+			for _, arg := range wrap.Args {
+				if handle, ok := arg.(*goast.CallExpr); ok {
+					x.Err = c.egoExpr(handle.Args[0]).(*ast.Ident)
+					x.Handler = c.node(reflect.ValueOf(handle.Args[1].(*goast.FuncLit).Body)).Interface().(*ast.BlockStmt)
+				} else {
+					x.Label = c.egoExpr(arg).(*ast.Ident)
+				}
+			}
+			return x
+		}
+		if isHandleCall(wrap) {
+			x.Err = c.egoExpr(wrap.Args[0]).(*ast.Ident)
+			x.Handler = c.node(reflect.ValueOf(wrap.Args[1].(*goast.FuncLit).Body)).Interface().(*ast.BlockStmt)
+			return x
+		}
+		x.Lparen = token.Pos(wrap.Lparen)
+		x.Rparen = token.Pos(wrap.Rparen)
+		for _, arg := range wrap.Args {
+			x.Args = append(x.Args, c.egoExpr(arg))
+		}
+	}
+	return x
+}
+
+// isTryCall reports whether call is a call of TryFunc converted from a try
+// expression.
+func isTryCall(call *goast.CallExpr) bool {
+	ident, ok := call.Fun.(*goast.Ident)
+	if !ok || ident.Name != TryFunc || call.Ellipsis.IsValid() {
+		return false
+	}
+	switch len(call.Args) {
+	case 1:
+		return true
+	case 2:
+		wrap, ok := call.Args[1].(*goast.CallExpr)
+		if !ok {
+			return false
+		}
+		ident, ok := wrap.Fun.(*goast.Ident)
+		return ok && ident.Name == WrapFunc || isHandleCall(wrap) || isBranchCall(wrap)
+	}
+	return false
+}
+
+// isBranchCall reports whether call is a call of ContinueFunc or BreakFunc
+// converted from `?continue` or `?break`.
+func isBranchCall(call *goast.CallExpr) bool {
+	ident, ok := call.Fun.(*goast.Ident)
+	if !ok || ident.Name != ContinueFunc && ident.Name != BreakFunc || call.Ellipsis.IsValid() {
+		return false
+	}
+	args := call.Args
+	if n := len(args); n > 0 {
+		if handle, ok := args[n-1].(*goast.CallExpr); ok && isHandleCall(handle) {
+			args = args[:n-1]
+		}
+	}
+	switch len(args) {
+	case 0:
+		return true
+	case 1:
+		_, ok := args[0].(*goast.Ident)
+		return ok
+	}
+	return false
+}
+
+// isHandleCall reports whether call is a call of HandleFunc converted from
+// the handler of a try expression or a handle statement.
+func isHandleCall(call *goast.CallExpr) bool {
+	ident, ok := call.Fun.(*goast.Ident)
+	if !ok || ident.Name != HandleFunc || len(call.Args) != 2 {
+		return false
+	}
+	_, ok = call.Args[0].(*goast.Ident)
+	_, isLit := call.Args[1].(*goast.FuncLit)
+	return ok && isLit
+}
+
+// mustToGo converts the must expression x to a call of MustFunc.
+func (c *converter) mustToGo(x *ast.MustExpr) *goast.CallExpr {
+	call := &goast.CallExpr{
+		Fun:    &goast.Ident{NamePos: gotoken.Pos(x.Pos()), Name: MustFunc},
+		Lparen: gotoken.Pos(x.Bang),
+		Rparen: gotoken.Pos(x.Bang),
+	}
+	c.seen[x] = reflect.ValueOf(call)
+	call.Args = []goast.Expr{c.goExpr(x.X)}
+	return call
+}
+
+// mustFromGo converts the call of MustFunc call to a must expression.
+func (c *converter) mustFromGo(call *goast.CallExpr) *ast.MustExpr {
+	x := &ast.MustExpr{Bang: token.Pos(call.Lparen)}
+	c.seen[call] = reflect.ValueOf(x)
+	x.X = c.egoExpr(call.Args[0])
+	return x
+}
+
+// isMustCall reports whether call is a call of MustFunc converted from a
+// must expression.
+func isMustCall(call *goast.CallExpr) bool {
+	ident, ok := call.Fun.(*goast.Ident)
+	return ok && ident.Name == MustFunc && len(call.Args) == 1 && !call.Ellipsis.IsValid()
+}
+
+// defaultToGo converts the default expression x to a call of DefaultFunc.
+func (c *converter) defaultToGo(x *ast.DefaultExpr) *goast.CallExpr {
+	call := &goast.CallExpr{
+		Fun:    &goast.Ident{NamePos: gotoken.Pos(x.Pos()), Name: DefaultFunc},
+		Lparen: gotoken.Pos(x.OpPos),
+		Rparen: gotoken.Pos(x.End() - 1),
+	}
+	c.seen[x] = reflect.ValueOf(call)
+	call.Args = []goast.Expr{c.goExpr(x.X), c.goExpr(x.Y)}
+	return call
+}
+
+// defaultFromGo converts the call of DefaultFunc call to a default
+// expression.
+func (c *converter) defaultFromGo(call *goast.CallExpr) *ast.DefaultExpr {
+	x := &ast.DefaultExpr{OpPos: token.Pos(call.Lparen)}
+	c.seen[call] = reflect.ValueOf(x)
+	x.X = c.egoExpr(call.Args[0])
+	x.Y = c.egoExpr(call.Args[1])
+	return x
+}
+
+// isDefaultCall reports whether call is a call of DefaultFunc converted from
+// a default expression.
+func isDefaultCall(call *goast.CallExpr) bool {
+	ident, ok := call.Fun.(*goast.Ident)
+	return ok && ident.Name == DefaultFunc && len(call.Args) == 2 && !call.Ellipsis.IsValid()
+}
+
+// goExpr converts the expression x to go/ast.
+func (c *converter) goExpr(x ast.Expr) goast.Expr {
+	return c.node(reflect.ValueOf(x)).Interface().(goast.Expr)
+}
+
+// egoExpr converts the expression x of go/ast.
+func (c *converter) egoExpr(x goast.Expr) ast.Expr {
+	return c.node(reflect.ValueOf(x)).Interface().(ast.Expr)
+}
@@ -0,0 +1,392 @@
+package astconv
+
+import (
+	"bytes"
+	goast "go/ast"
+	goformat "go/format"
+	"go/importer"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"testing"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/format"
+	"github.com/aisk/ego/parser"
+	"github.com/aisk/ego/token"
+)
+
+const src = `package p
+
+import "strconv"
+
+// atoi converts s.
+func atoi(s string) (int, error) {
+	n := strconv.Atoi(s)? // convert
+	m := strconv.Atoi(s)?("atoi %q", s)
+	k := strconv.Atoi(s)!
+	j := strconv.Atoi(s)? err {
+		return 0, err
+	}
+	i := strconv.Atoi(s) ?? -1
+	return n + m + k + j + i, nil
+}
+`
+
+func parse(t *testing.T) (*token.FileSet, *ast.File) {
+	t.Helper()
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.ego", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fset, file
+}
+
+func TestToGo(t *testing.T) {
+	fset, file := parse(t)
+	goFile := ToGo(file).(*goast.File)
+
+	var buf bytes.Buffer
+	if err := goformat.Node(&buf, ToGoFileSet(fset), goFile); err != nil {
+		t.Fatal(err)
+	}
+	want := `package p
+
+import "strconv"
+
+// atoi converts s.
+func atoi(s string) (int, error) {
+	n := __ego_try(strconv.Atoi(s)) // convert
+	m := __ego_try(strconv.Atoi(s), __ego_wrap("atoi %q", s))
+	k := __ego_must(strconv.Atoi(s))
+	j := __ego_try(strconv.Atoi(s), __ego_handle(err, func() {
+		return 0, err
+	}))
+	i := __ego_default(strconv.Atoi(s), -1)
+	return n + m + k + j + i, nil
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("ToGo printed\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestToGoPositions(t *testing.T) {
+	fset, file := parse(t)
+	goFset := ToGoFileSet(fset)
+	goFile := ToGo(file).(*goast.File)
+
+	var egoNodes []ast.Node
+	ast.Inspect(file, func(n ast.Node) bool {
+		if n != nil {
+			egoNodes = append(egoNodes, n)
+		}
+		return true
+	})
+	var goNodes []goast.Node
+	goast.Inspect(goFile, func(n goast.Node) bool {
+		if call, ok := n.(*goast.CallExpr); ok && (isTryCall(call) || isMustCall(call) || isDefaultCall(call)) {
+			// The function and the wrap and handle calls are not in the
+			// source.
+			goNodes = append(goNodes, call)
+			goast.Inspect(call.Args[0], func(n goast.Node) bool {
+				if n != nil {
+					goNodes = append(goNodes, n)
+				}
+				return true
+			})
+			if len(call.Args) > 1 {
+				var args []goast.Node
+				switch arg := call.Args[1].(type) {
+				case *goast.CallExpr:
+					for _, arg := range arg.Args {
+						args = append(args, arg)
+					}
+					if isHandleCall(arg) {
+						args = []goast.Node{arg.Args[0], arg.Args[1].(*goast.FuncLit).Body}
+					}
+				default:
+					// The default value.
+					args = append(args, arg)
+				}
+				for _, arg := range args {
+					goast.Inspect(arg, func(n goast.Node) bool {
+						if n != nil {
+							goNodes = append(goNodes, n)
+						}
+						return true
+					})
+				}
+			}
+			return false
+		}
+		if n != nil {
+			goNodes = append(goNodes, n)
+		}
+		return true
+	})
+	if len(goNodes) != len(egoNodes) {
+		t.Fatalf("got %d nodes, want %d", len(goNodes), len(egoNodes))
+	}
+	for i, n := range egoNodes {
+		got := goFset.Position(goNodes[i].Pos())
+		want := fset.Position(n.Pos())
+		if got.String() != want.String() || goNodes[i].End() != gotoken.Pos(n.End()) {
+			t.Errorf("%T at %s, want %T at %s", goNodes[i], got, n, want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	fset, file := parse(t)
+	back := FromGo(ToGo(file)).(*ast.File)
+
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, back); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != src {
+		t.Errorf("round trip printed\n%s\nwant\n%s", got, src)
+	}
+
+	// Resolved objects refer to the converted declarations.
+	fn := back.Decls[1].(*ast.FuncDecl)
+	ret := fn.Body.List[len(fn.Body.List)-1].(*ast.ReturnStmt)
+	x := ret.Results[0]
+	for sum, ok := x.(*ast.BinaryExpr); ok; sum, ok = x.(*ast.BinaryExpr) {
+		x = sum.X
+	}
+	n := x.(*ast.Ident)
+	assign := fn.Body.List[0].(*ast.AssignStmt)
+	if n.Obj == nil || n.Obj.Decl != assign {
+		t.Errorf("object of n declared by %v, want %v", n.Obj.Decl, assign)
+	}
+}
+
+func TestNot(t *testing.T) {
+	const src = `package p
+
+func f(m map[string]int) bool {
+	_, ok := m["k"]
+	return !ok
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.ego", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFile := ToGo(file).(*goast.File)
+	ret := goFile.Decls[0].(*goast.FuncDecl).Body.List[1].(*goast.ReturnStmt)
+	if op := ret.Results[0].(*goast.UnaryExpr).Op; op != gotoken.NOT {
+		t.Errorf("ToGo converted ! to %v, want %v", op, gotoken.NOT)
+	}
+
+	// A negation is not a must expression.
+	back := FromGo(goFile).(*ast.File)
+	ret2 := back.Decls[0].(*ast.FuncDecl).Body.List[1].(*ast.ReturnStmt)
+	if op := ret2.Results[0].(*ast.UnaryExpr).Op; op != token.NOT {
+		t.Errorf("FromGo converted ! to %v, want %v", op, token.NOT)
+	}
+	var buf bytes.Buffer
+	if err := format.Node(&buf, fset, back); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != src {
+		t.Errorf("round trip printed\n%s\nwant\n%s", got, src)
+	}
+}
+
+func TestHandleStmt(t *testing.T) {
+	const src = `package p
+
+func atoi(s string) (int, error) {
+	handle err {
+		return 0, err
+	}
+	return strconv.Atoi(s)?, nil
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.ego", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFile := ToGo(file).(*goast.File)
+
+	var buf bytes.Buffer
+	if err := goformat.Node(&buf, ToGoFileSet(fset), goFile); err != nil {
+		t.Fatal(err)
+	}
+	want := `package p
+
+func atoi(s string) (int, error) {
+	__ego_handle(err, func() {
+		return 0, err
+	})
+	return __ego_try(strconv.Atoi(s)), nil
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("ToGo printed\n%s\nwant\n%s", got, want)
+	}
+
+	back := FromGo(goFile).(*ast.File)
+	buf.Reset()
+	if err := format.Node(&buf, fset, back); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != src {
+		t.Errorf("round trip printed\n%s\nwant\n%s", got, src)
+	}
+	handle := back.Decls[0].(*ast.FuncDecl).Body.List[0].(*ast.HandleStmt)
+	ret := handle.Body.List[0].(*ast.ReturnStmt)
+	if obj := ret.Results[1].(*ast.Ident).Obj; obj == nil || obj.Decl != handle {
+		t.Errorf("object of err declared by %v, want %v", obj.Decl, handle)
+	}
+}
+
+func TestBranch(t *testing.T) {
+	const src = `package p
+
+func atoi(lines []string) {
+loop:
+	for _, s := range lines {
+		n := strconv.Atoi(s)?continue
+		m := strconv.Atoi(s)?break loop err {
+			println(err)
+		}
+		println(n, m)
+	}
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.ego", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFile := ToGo(file).(*goast.File)
+
+	var buf bytes.Buffer
+	if err := goformat.Node(&buf, ToGoFileSet(fset), goFile); err != nil {
+		t.Fatal(err)
+	}
+	want := `package p
+
+func atoi(lines []string) {
+loop:
+	for _, s := range lines {
+		n := __ego_try(strconv.Atoi(s), __ego_continue())
+		m := __ego_try(strconv.Atoi(s), __ego_break(loop, __ego_handle(err, func() {
+			println(err)
+		})))
+		println(n, m)
+	}
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("ToGo printed\n%s\nwant\n%s", got, want)
+	}
+
+	back := FromGo(goFile).(*ast.File)
+	buf.Reset()
+	if err := format.Node(&buf, fset, back); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != src {
+		t.Errorf("round trip printed\n%s\nwant\n%s", got, src)
+	}
+}
+
+func TestDefer(t *testing.T) {
+	const src = `package p
+
+func write(name string, data []byte) error {
+	f := os.Create(name)?
+	defer? f.Close()
+	f.Write(data)?
+	return nil
+}
+`
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "p.ego", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	goFile := ToGo(file).(*goast.File)
+
+	var buf bytes.Buffer
+	if err := goformat.Node(&buf, ToGoFileSet(fset), goFile); err != nil {
+		t.Fatal(err)
+	}
+	want := `package p
+
+func write(name string, data []byte) error {
+	f := __ego_try(os.Create(name))
+	defer __ego_defer(f.Close())
+	__ego_try(f.Write(data))
+	return nil
+}
+`
+	if got := buf.String(); got != want {
+		t.Errorf("ToGo printed\n%s\nwant\n%s", got, want)
+	}
+
+	back := FromGo(goFile).(*ast.File)
+	buf.Reset()
+	if err := format.Node(&buf, fset, back); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); got != src {
+		t.Errorf("round trip printed\n%s\nwant\n%s", got, src)
+	}
+}
+
+func TestTypeCheck(t *testing.T) {
+	fset, file := parse(t)
+	goFset := ToGoFileSet(fset)
+	goFile := ToGo(file).(*goast.File)
+	helper, err := goparser.ParseFile(goFset, "helper.go", `package p
+
+func __ego_try[T any](v T, _ error) T { return v }
+
+func __ego_must[T any](v T, _ error) T { return v }
+
+func __ego_default[T any](v T, _ error) T { return v }
+`, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A multiple-value operand must be the only argument.
+	goast.Inspect(goFile, func(n goast.Node) bool {
+		if call, ok := n.(*goast.CallExpr); ok && (isTryCall(call) || isDefaultCall(call)) {
+			call.Args = call.Args[:1]
+		}
+		return true
+	})
+
+	isTruncatedDefault := func(call *goast.CallExpr) bool {
+		ident, ok := call.Fun.(*goast.Ident)
+		return ok && ident.Name == DefaultFunc
+	}
+
+	info := &types.Info{Types: make(map[goast.Expr]types.TypeAndValue)}
+	conf := types.Config{Importer: importer.ForCompiler(goFset, "source", nil)}
+	if _, err := conf.Check("p", goFset, []*goast.File{goFile, helper}, info); err != nil {
+		t.Fatal(err)
+	}
+	var tries int
+	goast.Inspect(goFile, func(n goast.Node) bool {
+		if call, ok := n.(*goast.CallExpr); ok && (isTryCall(call) || isMustCall(call) || isTruncatedDefault(call)) {
+			tries++
+			if got := info.Types[call].Type.String(); got != "int" {
+				t.Errorf("try expression at %s of type %s, want int", goFset.Position(call.Pos()), got)
+			}
+		}
+		return true
+	})
+	if tries != 5 {
+		t.Errorf("found %d try, must and default expressions, want 5", tries)
+	}
+}
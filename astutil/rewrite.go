@@ -274,6 +274,17 @@ func (a *application) apply(parent ast.Node, name string, iter *iterator, n ast.
 
 	case *ast.TryExpr:
 		a.apply(n, "X", nil, n.X)
+		a.applyList(n, "Args")
+		a.apply(n, "Label", nil, n.Label)
+		a.apply(n, "Err", nil, n.Err)
+		a.apply(n, "Handler", nil, n.Handler)
+
+	case *ast.DefaultExpr:
+		a.apply(n, "X", nil, n.X)
+		a.apply(n, "Y", nil, n.Y)
+
+	case *ast.MustExpr:
+		a.apply(n, "X", nil, n.X)
 
 	case *ast.StarExpr:
 		a.apply(n, "X", nil, n.X)
@@ -348,6 +359,10 @@ func (a *application) apply(parent ast.Node, name string, iter *iterator, n ast.
 	case *ast.DeferStmt:
 		a.apply(n, "Call", nil, n.Call)
 
+	case *ast.HandleStmt:
+		a.apply(n, "Err", nil, n.Err)
+		a.apply(n, "Body", nil, n.Body)
+
 	case *ast.ReturnStmt:
 		a.applyList(n, "Results")
 
@@ -4,4 +4,7 @@ go 1.24.3
 
 require golang.org/x/term v0.23.0
 
-require golang.org/x/sys v0.23.0 // indirect
+require (
+	github.com/pkg/errors v0.9.1 // indirect
+	golang.org/x/sys v0.23.0 // indirect
+)
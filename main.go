@@ -11,7 +11,24 @@ import (
 	"golang.org/x/term"
 )
 
+// options configures the transpilation of every file.
+var options transpiler.Options
+
 func main() {
+	flag.BoolVar(&options.TypeCheck, "typecheck", false, "type-check the package of each file before transpiling it")
+	flag.Func("fallback", "lowering of ? in functions without an error result: none, fatal or panic", func(s string) error {
+		switch fallback := transpiler.Fallback(s); fallback {
+		case transpiler.FallbackNone, transpiler.FallbackFatal, transpiler.FallbackPanic:
+			options.Fallback = fallback
+			return nil
+		}
+		return fmt.Errorf("want none, fatal or panic")
+	})
+	flag.StringVar(&options.FatalHandler, "fatal-handler", "", "function main calls with the error instead of log.Fatal with -fallback=fatal")
+	flag.BoolVar(&options.Annotate, "annotate", false, "wrap propagated errors with the function name and .ego position")
+	flag.StringVar(&options.Hook, "hook", "", "function called with propagated errors, the function name and .ego position, as in [name=]path.Func")
+	flag.StringVar(&options.CommaOkError, "comma-ok-error", "", "function making the errors of failed map indexes, type assertions and receives instead of fmt.Errorf, as in [name=]path.Func")
+	flag.BoolVar(&options.DeferFirstError, "defer-first-error", false, "make defer? return the error of the deferred call only when the function succeeds otherwise")
 	flag.Usage = func() {
 		fmt.Fprintf(os.Stderr, "Usage: ego [options] [files...|folders...]\n")
 		fmt.Fprintf(os.Stderr, "\nOptions:\n")
@@ -20,6 +37,10 @@ func main() {
 		fmt.Fprintf(os.Stderr, "  ego file1.ego file2.ego    # Transpile specific files\n")
 		fmt.Fprintf(os.Stderr, "  ego ./folder               # Transpile all .ego files in folder\n")
 		fmt.Fprintf(os.Stderr, "  ego ./...                  # Transpile all .ego files recursively\n")
+		fmt.Fprintf(os.Stderr, "  ego -typecheck ./folder    # Type-check the package before transpiling\n")
+		fmt.Fprintf(os.Stderr, "  ego -fallback=fatal ./...  # Allow ? in main and tests\n")
+		fmt.Fprintf(os.Stderr, "  ego -annotate ./...        # Add the origin of propagated errors\n")
+		fmt.Fprintf(os.Stderr, "  ego -hook=example.com/errtrace.Record ./...  # Record propagated errors\n")
 		fmt.Fprintf(os.Stderr, "  ego                        # Transpile file from stdin\n")
 	}
 	flag.Parse()
@@ -35,7 +56,7 @@ func main() {
 		}
 
 		// stdin is redirected - process it
-		if err := transpiler.Transpile(os.Stdin, os.Stdout); err != nil {
+		if err := transpiler.TranspileWithOptions(os.Stdin, os.Stdout, options); err != nil {
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
@@ -118,7 +139,7 @@ func transpileFile(inputPath string) error {
 	}
 	defer outputFile.Close()
 
-	if err := transpiler.Transpile(inputFile, outputFile); err != nil {
+	if err := transpiler.TranspileWithOptions(inputFile, outputFile, options); err != nil {
 		return fmt.Errorf("transpilation failed: %w", err)
 	}
 
@@ -1663,6 +1663,59 @@ func (p *parser) parseCallOrConversion(fun ast.Expr) *ast.CallExpr {
 	return &ast.CallExpr{Fun: fun, Lparen: lparen, Args: list, Ellipsis: ellipsis, Rparen: rparen}
 }
 
+func (p *parser) parseTryExpr(x ast.Expr) *ast.TryExpr {
+	if p.trace {
+		defer un(trace(p, "TryExpr"))
+	}
+
+	question := p.expect(token.QUESTION)
+	if p.tok == token.CONTINUE || p.tok == token.BREAK {
+		// x?continue and x?break continue or break out of a loop, optionally
+		// labeled, after an optional handler.
+		tryX := &ast.TryExpr{X: x, Question: question, BranchPos: p.pos, Branch: p.tok}
+		p.next()
+		if p.tok != token.IDENT {
+			return tryX
+		}
+		name := p.parseIdent()
+		switch {
+		case p.tok == token.IDENT:
+			tryX.Label = name
+			name = p.parseIdent()
+		case p.tok != token.LBRACE || p.exprLev < 0:
+			// In control clauses, the block is the body of the statement.
+			tryX.Label = name
+			return tryX
+		}
+		tryX.Err = name
+		p.exprLev++
+		tryX.Handler = p.parseBlockStmt()
+		p.exprLev--
+		return tryX
+	}
+	if p.tok == token.IDENT {
+		// x? err { ... } handles the error in the block.
+		errName := p.parseIdent()
+		p.exprLev++
+		handler := p.parseBlockStmt()
+		p.exprLev--
+		return &ast.TryExpr{X: x, Question: question, Err: errName, Handler: handler}
+	}
+	if p.tok != token.LPAREN {
+		return &ast.TryExpr{X: x, Question: question}
+	}
+
+	// x?("message", args...) wraps the propagated error.
+	wrap := p.parseCallOrConversion(nil)
+	if len(wrap.Args) == 0 {
+		p.error(wrap.Rparen, "missing error wrap message")
+	}
+	if wrap.Ellipsis.IsValid() {
+		p.error(wrap.Ellipsis, "unexpected ... in error wrap message")
+	}
+	return &ast.TryExpr{X: x, Question: question, Lparen: wrap.Lparen, Args: wrap.Args, Rparen: wrap.Rparen}
+}
+
 func (p *parser) parseValue() ast.Expr {
 	if p.trace {
 		defer un(trace(p, "Element"))
@@ -1768,9 +1821,16 @@ func (p *parser) parsePrimaryExpr(x ast.Expr) ast.Expr {
 		case token.LPAREN:
 			x = p.parseCallOrConversion(x)
 		case token.QUESTION:
+			x = p.parseTryExpr(x)
+		case token.BANG:
+			x = &ast.MustExpr{X: x, Bang: p.pos}
+			p.next()
+		case token.COALESCE:
+			// x ?? y is right-associative, as the default value y is
+			// parsed along with the operators following it.
 			pos := p.pos
 			p.next()
-			x = &ast.TryExpr{X: x, Question: pos}
+			x = &ast.DefaultExpr{X: x, OpPos: pos, Y: p.parseUnaryExpr()}
 		case token.LBRACE:
 			// operand may have returned a parenthesized complit
 			// type; accept it but complain if we have a complit
@@ -1861,7 +1921,7 @@ func (p *parser) parseUnaryExpr() ast.Expr {
 		}
 
 		// <-(expr)
-		return &ast.UnaryExpr{OpPos: arrow, Op: token.ARROW, X: x}
+		return receive(arrow, x)
 
 	case token.MUL:
 		// pointer type or unary "*" expression
@@ -1874,6 +1934,30 @@ func (p *parser) parseUnaryExpr() ast.Expr {
 	return p.parsePrimaryExpr(nil)
 }
 
+// receive returns the receive expression from x at arrow. The try, must
+// or default expression of an operand other than a call applies to the
+// receive rather than to its operand, which holds no error, so that <-ch?
+// is (<-ch)? and fails when ch is closed.
+func receive(arrow token.Pos, x ast.Expr) ast.Expr {
+	var operand *ast.Expr
+	switch t := x.(type) {
+	case *ast.TryExpr:
+		operand = &t.X
+	case *ast.MustExpr:
+		operand = &t.X
+	case *ast.DefaultExpr:
+		operand = &t.X
+	}
+	if operand == nil {
+		return &ast.UnaryExpr{OpPos: arrow, Op: token.ARROW, X: x}
+	}
+	if _, isCall := ast.Unparen(*operand).(*ast.CallExpr); isCall {
+		return &ast.UnaryExpr{OpPos: arrow, Op: token.ARROW, X: x}
+	}
+	*operand = receive(arrow, *operand)
+	return x
+}
+
 func (p *parser) tokPrec() (token.Token, int) {
 	tok := p.tok
 	if p.inRhs && tok == token.ASSIGN {
@@ -2009,6 +2093,15 @@ func (p *parser) parseSimpleStmt(mode int) (ast.Stmt, bool) {
 		s := &ast.IncDecStmt{X: x[0], TokPos: p.pos, Tok: p.tok}
 		p.next()
 		return s, false
+
+	case token.IDENT:
+		// error handler declaration; handle is not a keyword, so that it
+		// remains usable as an identifier
+		if handle, isIdent := x[0].(*ast.Ident); mode == labelOk && isIdent && handle.Name == "handle" {
+			err := p.parseIdent()
+			body := p.parseBlockStmt()
+			return &ast.HandleStmt{Handle: handle.Pos(), Err: err, Body: body}, false
+		}
 	}
 
 	// expression
@@ -2052,13 +2145,18 @@ func (p *parser) parseDeferStmt() ast.Stmt {
 	}
 
 	pos := p.expect(token.DEFER)
+	var question token.Pos
+	if p.tok == token.QUESTION {
+		question = p.pos
+		p.next()
+	}
 	call := p.parseCallExpr("defer")
 	p.expectSemi()
 	if call == nil {
 		return &ast.BadStmt{From: pos, To: pos + 5} // len("defer")
 	}
 
-	return &ast.DeferStmt{Defer: pos, Call: call}
+	return &ast.DeferStmt{Defer: pos, Question: question, Call: call}
 }
 
 func (p *parser) parseReturnStmt() *ast.ReturnStmt {
@@ -919,4 +919,64 @@ func TestTryExpr(t *testing.T) {
 	if fset.Position(tryExpr.Question).Offset != 30 {
 		t.Errorf("expected '?' at offset %d, got %d", 30, fset.Position(tryExpr.Question).Offset)
 	}
-}
\ No newline at end of file
+}
+
+func TestTryExprWrap(t *testing.T) {
+	src := `package p; func f() { myFunc()?("call %s", name) }`
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tryExpr := f.Decls[0].(*ast.FuncDecl).Body.List[0].(*ast.ExprStmt).X.(*ast.TryExpr)
+	if _, ok := tryExpr.X.(*ast.CallExpr); !ok {
+		t.Errorf("expected call expression, got %T", tryExpr.X)
+	}
+	if len(tryExpr.Args) != 2 {
+		t.Fatalf("expected 2 wrap arguments, got %d", len(tryExpr.Args))
+	}
+	if lit, ok := tryExpr.Args[0].(*ast.BasicLit); !ok || lit.Value != `"call %s"` {
+		t.Errorf("expected wrap message \"call %%s\", got %v", tryExpr.Args[0])
+	}
+	if got := fset.Position(tryExpr.End()).Offset; got != len(src)-2 {
+		t.Errorf("expected TryExpr to end at offset %d, got %d", len(src)-2, got)
+	}
+
+	for _, src := range []string{
+		`package p; func f() { myFunc()?() }`,
+		`package p; func f() { myFunc()?(args...) }`,
+	} {
+		if _, err := ParseFile(fset, "", src, 0); err == nil {
+			t.Errorf("%s: expected error", src)
+		}
+	}
+}
+
+func TestTryExprReceive(t *testing.T) {
+	src := `package p; func f() { _ = <-ch?; _ = <-newChan()? }`
+	fset := token.NewFileSet()
+	f, err := ParseFile(fset, "", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	list := f.Decls[0].(*ast.FuncDecl).Body.List
+
+	// The try expression applies to the receive from ch...
+	tryExpr, ok := list[0].(*ast.AssignStmt).Rhs[0].(*ast.TryExpr)
+	if !ok {
+		t.Fatalf("expected TryExpr, got %T", list[0].(*ast.AssignStmt).Rhs[0])
+	}
+	if recv, ok := tryExpr.X.(*ast.UnaryExpr); !ok || recv.Op != token.ARROW {
+		t.Errorf("expected receive expression, got %T", tryExpr.X)
+	}
+
+	// ...but to the call returning a channel.
+	recv, ok := list[1].(*ast.AssignStmt).Rhs[0].(*ast.UnaryExpr)
+	if !ok {
+		t.Fatalf("expected UnaryExpr, got %T", list[1].(*ast.AssignStmt).Rhs[0])
+	}
+	if _, ok := recv.X.(*ast.TryExpr); !ok {
+		t.Errorf("expected TryExpr, got %T", recv.X)
+	}
+}
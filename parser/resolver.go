@@ -264,6 +264,22 @@ func (r *resolver) Visit(node ast.Node) ast.Visitor {
 		r.walkFuncType(n.Type)
 		r.walkBody(n.Body)
 
+	case *ast.TryExpr:
+		ast.Walk(r, n.X)
+		r.walkExprs(n.Args)
+		if n.Label != nil {
+			// add to list of unresolved targets
+			depth := len(r.targetStack) - 1
+			r.targetStack[depth] = append(r.targetStack[depth], n.Label)
+		}
+		if n.Handler != nil {
+			// The error is declared in the scope of the handler.
+			r.openScope(n.Handler.Pos())
+			defer r.closeScope()
+			r.declare(n, nil, r.topScope, ast.Var, n.Err)
+			r.walkStmts(n.Handler.List)
+		}
+
 	case *ast.SelectorExpr:
 		ast.Walk(r, n.X)
 		// Note: don't try to resolve n.Sel, as we don't support qualified
@@ -329,6 +345,13 @@ func (r *resolver) Visit(node ast.Node) ast.Visitor {
 		defer r.closeScope()
 		r.walkStmts(n.List)
 
+	case *ast.HandleStmt:
+		// The error is declared in the scope of the handler.
+		r.openScope(n.Body.Pos())
+		defer r.closeScope()
+		r.declare(n, nil, r.topScope, ast.Var, n.Err)
+		r.walkStmts(n.Body.List)
+
 	case *ast.IfStmt:
 		r.openScope(n.Pos())
 		defer r.closeScope()
@@ -810,6 +810,18 @@ func isBinary(expr ast.Expr) bool {
 	return ok
 }
 
+// operandPrec returns the precedence the operand x of a try, must or
+// default expression is printed at. The parser applies them to a receive
+// whose operand is not a call, as in <-ch?, which needs no parentheses.
+func operandPrec(x ast.Expr) int {
+	if u, ok := x.(*ast.UnaryExpr); ok && u.Op == token.ARROW {
+		if _, isCall := ast.Unparen(u.X).(*ast.CallExpr); !isCall {
+			return token.UnaryPrec
+		}
+	}
+	return token.HighestPrec
+}
+
 func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 	p.setPos(expr.Pos())
 
@@ -1008,6 +1020,47 @@ func (p *printer) expr1(expr ast.Expr, prec1, depth int) {
 			p.print(unindent)
 		}
 
+	case *ast.TryExpr:
+		startCol := p.out.Column
+		p.expr1(x.X, operandPrec(x.X), depth)
+		p.setPos(x.Question)
+		p.print(token.QUESTION)
+		if x.Lparen.IsValid() {
+			if len(x.Args) > 1 {
+				depth++
+			}
+			p.setPos(x.Lparen)
+			p.print(token.LPAREN)
+			p.exprList(x.Lparen, x.Args, depth, commaTerm, x.Rparen, false)
+			p.setPos(x.Rparen)
+			p.print(token.RPAREN)
+		}
+		if x.BranchPos.IsValid() {
+			p.setPos(x.BranchPos)
+			p.print(x.Branch)
+			if x.Label != nil {
+				p.print(blank)
+				p.expr(x.Label)
+			}
+		}
+		if x.Handler != nil {
+			p.print(blank)
+			p.expr(x.Err)
+			p.funcBody(p.distanceFrom(x.Pos(), startCol), blank, x.Handler)
+		}
+
+	case *ast.DefaultExpr:
+		p.expr1(x.X, operandPrec(x.X), depth)
+		p.print(blank)
+		p.setPos(x.OpPos)
+		p.print(token.COALESCE, blank)
+		p.expr1(x.Y, token.UnaryPrec, depth)
+
+	case *ast.MustExpr:
+		p.expr1(x.X, operandPrec(x.X), depth)
+		p.setPos(x.Bang)
+		p.print(token.BANG)
+
 	case *ast.CompositeLit:
 		// composite literal elements that are composite literals themselves may have the type omitted
 		if x.Type != nil {
@@ -1411,9 +1464,21 @@ func (p *printer) stmt(stmt ast.Stmt, nextIsRBrace bool) {
 		p.expr(s.Call)
 
 	case *ast.DeferStmt:
-		p.print(token.DEFER, blank)
+		p.print(token.DEFER)
+		if s.Question.IsValid() {
+			p.setPos(s.Question)
+			p.print(token.QUESTION)
+		}
+		p.print(blank)
 		p.expr(s.Call)
 
+	case *ast.HandleStmt:
+		p.expr(&ast.Ident{NamePos: s.Handle, Name: "handle"})
+		p.print(blank)
+		p.expr(s.Err)
+		p.print(blank)
+		p.block(s.Body, 1)
+
 	case *ast.ReturnStmt:
 		p.print(token.RETURN)
 		if s.Results != nil {
@@ -40,6 +40,7 @@ type Scanner struct {
 	rdOffset   int       // reading offset (position after current character)
 	lineOffset int       // current line offset
 	insertSemi bool      // insert a semicolon before next newline
+	operand    bool      // preceding token ends an operand
 	nlPos      token.Pos // position of newline in preceding comment
 
 	// public state - ok to modify
@@ -146,6 +147,7 @@ func (s *Scanner) Init(file *token.File, src []byte, err ErrorHandler, mode Mode
 	s.rdOffset = 0
 	s.lineOffset = 0
 	s.insertSemi = false
+	s.operand = false
 	s.ErrorCount = 0
 
 	s.next()
@@ -804,6 +806,7 @@ scanAgain:
 		// containing newline, at position of first newline.
 		pos, tok, lit = s.nlPos, token.SEMICOLON, "\n"
 		s.nlPos = token.NoPos
+		s.operand = false
 		return
 	}
 
@@ -814,6 +817,7 @@ scanAgain:
 
 	// determine token value
 	insertSemi := false
+	operand := false
 	switch ch := s.ch; {
 	case isLetter(ch):
 		lit = s.scanIdentifier()
@@ -828,8 +832,10 @@ scanAgain:
 			insertSemi = true
 			tok = token.IDENT
 		}
+		operand = tok == token.IDENT
 	case isDecimal(ch) || ch == '.' && isDecimal(rune(s.peek())):
 		insertSemi = true
+		operand = true
 		tok, lit = s.scanNumber()
 	default:
 		s.next() // always make progress
@@ -837,6 +843,7 @@ scanAgain:
 		case eof:
 			if s.insertSemi {
 				s.insertSemi = false // EOF consumed
+				s.operand = false
 				return pos, token.SEMICOLON, "\n"
 			}
 			tok = token.EOF
@@ -845,24 +852,33 @@ scanAgain:
 			// set in the first place and exited early
 			// from s.skipWhitespace()
 			s.insertSemi = false // newline consumed
+			s.operand = false
 			return pos, token.SEMICOLON, "\n"
 		case '"':
 			insertSemi = true
+			operand = true
 			tok = token.STRING
 			lit = s.scanString()
 		case '\'':
 			insertSemi = true
+			operand = true
 			tok = token.CHAR
 			lit = s.scanRune()
 		case '`':
 			insertSemi = true
+			operand = true
 			tok = token.STRING
 			lit = s.scanRawString()
 		case ':':
 			tok = s.switch2(token.COLON, token.DEFINE)
 		case '?':
-			insertSemi = true
-			tok = token.QUESTION
+			if s.ch == '?' {
+				s.next()
+				tok = token.COALESCE
+			} else {
+				insertSemi = true
+				tok = token.QUESTION
+			}
 		case '.':
 			// fractions starting with a '.' are handled by outer switch
 			tok = token.PERIOD
@@ -880,16 +896,19 @@ scanAgain:
 			tok = token.LPAREN
 		case ')':
 			insertSemi = true
+			operand = true
 			tok = token.RPAREN
 		case '[':
 			tok = token.LBRACK
 		case ']':
 			insertSemi = true
+			operand = true
 			tok = token.RBRACK
 		case '{':
 			tok = token.LBRACE
 		case '}':
 			insertSemi = true
+			operand = true
 			tok = token.RBRACE
 		case '+':
 			tok = s.switch3(token.ADD, token.ADD_ASSIGN, '+', token.INC)
@@ -915,6 +934,7 @@ scanAgain:
 				} else {
 					insertSemi = s.insertSemi // preserve insertSemi info
 				}
+				operand = s.operand
 				if s.mode&ScanComments == 0 {
 					// skip comment
 					goto scanAgain
@@ -941,7 +961,13 @@ scanAgain:
 		case '=':
 			tok = s.switch2(token.ASSIGN, token.EQL)
 		case '!':
-			tok = s.switch2(token.NOT, token.NEQ)
+			if s.operand && s.ch != '=' {
+				// x! panics if the error of x is not nil
+				insertSemi = true
+				tok = token.BANG
+			} else {
+				tok = s.switch2(token.NOT, token.NEQ)
+			}
 		case '&':
 			if s.ch == '^' {
 				s.next()
@@ -972,6 +998,7 @@ scanAgain:
 	if s.mode&dontInsertSemis == 0 {
 		s.insertSemi = insertSemi
 	}
+	s.operand = operand
 
 	return
 }
@@ -152,6 +152,7 @@ var tokens = []elt{
 	{token.SEMICOLON, ";", operator},
 	{token.COLON, ":", operator},
 	{token.TILDE, "~", operator},
+	{token.COALESCE, "??", operator},
 
 	// Keywords
 	{token.BREAK, "break", keyword},
@@ -505,6 +506,37 @@ func TestSemicolons(t *testing.T) {
 	}
 }
 
+func TestBang(t *testing.T) {
+	for _, test := range []struct {
+		input string
+		want  []token.Token
+	}{
+		{"f()!", []token.Token{token.IDENT, token.LPAREN, token.RPAREN, token.BANG, token.SEMICOLON}},
+		{"x!\n", []token.Token{token.IDENT, token.BANG, token.SEMICOLON}},
+		{"x /* c */ !", []token.Token{token.IDENT, token.BANG, token.SEMICOLON}},
+		{"m[k]!!", []token.Token{token.IDENT, token.LBRACK, token.IDENT, token.RBRACK, token.BANG, token.NOT}},
+		{"!x", []token.Token{token.NOT, token.IDENT, token.SEMICOLON}},
+		{"x != y", []token.Token{token.IDENT, token.NEQ, token.IDENT, token.SEMICOLON}},
+		{"x && !y", []token.Token{token.IDENT, token.LAND, token.NOT, token.IDENT, token.SEMICOLON}},
+		{"return !ok", []token.Token{token.RETURN, token.NOT, token.IDENT, token.SEMICOLON}},
+		{"x\n!y", []token.Token{token.IDENT, token.SEMICOLON, token.NOT, token.IDENT, token.SEMICOLON}},
+	} {
+		var s Scanner
+		s.Init(fset.AddFile("", fset.Base(), len(test.input)), []byte(test.input), nil, 0)
+		var got []token.Token
+		for {
+			_, tok, _ := s.Scan()
+			if tok == token.EOF {
+				break
+			}
+			got = append(got, tok)
+		}
+		if !slices.Equal(got, test.want) {
+			t.Errorf("scanning %q, got %v, want %v", test.input, got, test.want)
+		}
+	}
+}
+
 type segment struct {
 	srcline      string // a line of source text
 	filename     string // filename for current token; error message for invalid line directives
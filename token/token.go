@@ -91,6 +91,8 @@ const (
 	SEMICOLON // ;
 	COLON     // :
 	QUESTION  // ?
+	BANG      // ! (postfix)
+	COALESCE  // ??
 	operator_end
 
 	keyword_beg
@@ -201,7 +203,9 @@ var tokens = [...]string{
 	SEMICOLON: ";",
 	COLON:     ":",
 
-	QUESTION:  "?",
+	QUESTION: "?",
+	BANG:     "!",
+	COALESCE: "??",
 
 	BREAK:    "break",
 	CASE:     "case",
@@ -0,0 +1,110 @@
+package transpiler
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// annotate wraps errExpr, the error propagated by x from fn, with the name
+// of fn and the position of x when annotations are enabled, as in
+//
+//	fmt.Errorf("loadConfig (config.ego:42): %w", err)
+//
+// An error wrapped with a message gets the annotation in front of it.
+func (t *transpiler) annotate(fn *function, x *ast.TryExpr, errExpr ast.Expr) ast.Expr {
+	if !t.annotations {
+		return errExpr
+	}
+	prefix := fmt.Sprintf("%s (%s): ", t.funcName(fn), t.shortPos(x))
+	if call, ok := errExpr.(*ast.CallExpr); ok && len(x.Args) > 0 {
+		// The format of the fmt.Errorf call of genErrExpr, which is a valid
+		// string literal.
+		format := call.Args[0].(*ast.BasicLit)
+		msg, _ := strconv.Unquote(format.Value)
+		format.Value = strconv.Quote(escapeVerbs(prefix) + msg)
+		return call
+	}
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   t.pkgIdent("fmt"),
+			Sel: &ast.Ident{Name: "Errorf"},
+		},
+		Args: []ast.Expr{
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(escapeVerbs(prefix) + "%w")},
+			errExpr,
+		},
+	}
+}
+
+// shortPos returns the position of x as the base name of its file and its
+// line, as in "config.ego:42".
+func (t *transpiler) shortPos(x *ast.TryExpr) string {
+	pos := t.fset.Position(x.Pos())
+	return fmt.Sprintf("%s:%d", filepath.Base(pos.Filename), pos.Line)
+}
+
+// escapeVerbs escapes the percent signs of s for use in a format.
+func escapeVerbs(s string) string {
+	return strings.ReplaceAll(s, "%", "%%")
+}
+
+// funcName returns the name of fn as Go stack traces print it, without the
+// package: F, T.M or (*T).M for declarations, and F.func1 for the first
+// literal in F, F.func1.1 for the first literal in it, and so on.
+func (t *transpiler) funcName(fn *function) string {
+	if fn.decl != nil {
+		recv := fn.decl.Recv
+		if recv == nil || len(recv.List) == 0 {
+			return fn.decl.Name.Name
+		}
+		typ := recv.List[0].Type
+		star, isPtr := typ.(*ast.StarExpr)
+		if isPtr {
+			typ = star.X
+		}
+		switch x := typ.(type) {
+		case *ast.IndexExpr:
+			typ = x.X
+		case *ast.IndexListExpr:
+			typ = x.X
+		}
+		name := typeString(typ)
+		if isPtr {
+			return "(*" + name + ")." + fn.decl.Name.Name
+		}
+		return name + "." + fn.decl.Name.Name
+	}
+
+	// Number the literals directly in the enclosing function, or at the
+	// top level of the file.
+	var outer ast.Node = t.file
+	name := "func"
+	if fn.outer != nil {
+		outer = fn.outer.Body
+		name = t.funcName(fn.outer) + ".func"
+		if fn.outer.decl == nil {
+			// Literals in literals only get their number.
+			name = t.funcName(fn.outer) + "."
+		}
+	}
+	n, found := 0, false
+	ast.Inspect(outer, func(node ast.Node) bool {
+		switch node := node.(type) {
+		case *ast.FuncDecl:
+			return false
+		case *ast.FuncLit:
+			if !found {
+				n++
+				found = node.Body == fn.Body
+			}
+			return false
+		}
+		return !found
+	})
+	return name + strconv.Itoa(n)
+}
@@ -0,0 +1,132 @@
+package transpiler
+
+import (
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// target is a statement enclosing a try expression, which the break and
+// continue statements generated for it may refer to.
+type target struct {
+	stmt  ast.Stmt // for, range, switch, type switch or select statement
+	label string   // label of the statement; or ""
+}
+
+// checkBranches reports an error for a `?continue` or `?break` of the file
+// that is not in a loop, or whose label does not name an enclosing loop,
+// or an enclosing switch or select statement for `?break`.
+func (t *transpiler) checkBranches() error {
+	return t.checkBranchesIn(t.file, nil)
+}
+
+// checkBranchesIn checks the try expressions in n, which is enclosed by
+// targets, innermost last.
+func (t *transpiler) checkBranchesIn(n ast.Node, targets []target) error {
+	var err error
+	check := func(n ast.Node, targets []target) bool {
+		if n != nil && err == nil {
+			err = t.checkBranchesIn(n, targets)
+		}
+		return err == nil
+	}
+	ast.Inspect(n, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		label := ""
+		if labeled, ok := n.(*ast.LabeledStmt); ok {
+			label, n = labeled.Label.Name, labeled.Stmt
+		}
+		// enter returns the targets of the body of s.
+		enter := func(s ast.Stmt) []target {
+			return append(targets[:len(targets):len(targets)], target{s, label})
+		}
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			check(x.Body, nil)
+			return false
+		case *ast.ForStmt:
+			// The condition and the post statement are evaluated in the
+			// body once lowered, where branches would refer to x.
+			_ = check(x.Init, targets) && check(x.Cond, nil) && check(x.Post, nil) && check(x.Body, enter(x))
+			return false
+		case *ast.RangeStmt:
+			_ = check(x.X, targets) && check(x.Body, enter(x))
+			return false
+		case *ast.SwitchStmt:
+			_ = check(x.Init, targets) && check(x.Tag, targets) && check(x.Body, enter(x))
+			return false
+		case *ast.TypeSwitchStmt:
+			_ = check(x.Init, targets) && check(x.Assign, targets) && check(x.Body, enter(x))
+			return false
+		case *ast.SelectStmt:
+			check(x.Body, enter(x))
+			return false
+		case *ast.TryExpr:
+			if x.BranchPos.IsValid() {
+				err = t.checkBranch(x, targets)
+			}
+		}
+		return err == nil
+	})
+	return err
+}
+
+// checkBranch checks the `?continue` or `?break` x enclosed by targets.
+func (t *transpiler) checkBranch(x *ast.TryExpr, targets []target) error {
+	kind := "?" + x.Branch.String()
+	for i := len(targets) - 1; i >= 0; i-- {
+		_, isFor := targets[i].stmt.(*ast.ForStmt)
+		_, isRange := targets[i].stmt.(*ast.RangeStmt)
+		isLoop := isFor || isRange
+		switch {
+		case x.Label != nil:
+			if targets[i].label != x.Label.Name {
+				continue
+			}
+			if !isLoop && x.Branch == token.CONTINUE {
+				return t.errorf(x.Label.Pos(), "invalid %s label %s", kind, x.Label.Name)
+			}
+			return nil
+		case isLoop:
+			return nil
+		case x.Branch == token.BREAK:
+			// A break statement would break out of the switch or select
+			// statement rather than the loop.
+			return t.errorf(x.BranchPos, "unlabeled %s in a switch or select statement", kind)
+		}
+	}
+	if x.Label != nil {
+		return t.errorf(x.Label.Pos(), "invalid %s label %s", kind, x.Label.Name)
+	}
+	return t.errorf(x.BranchPos, "%s is not in a loop", kind)
+}
+
+// genBranch generates the error check of the `?continue` or `?break` x,
+// which runs the handler of x, if any, before continuing or breaking out of
+// the loop.
+func (t *transpiler) genBranch(fn *function, x *ast.TryExpr, errVar string) (*ast.IfStmt, error) {
+	branch := &ast.BranchStmt{Tok: x.Branch}
+	if x.Label != nil {
+		branch.Label = &ast.Ident{Name: x.Label.Name}
+	}
+	body := &ast.BlockStmt{}
+	if x.Handler != nil {
+		if x.Err.Name == "_" {
+			return nil, t.errorf(x.Err.Pos(), "cannot use _ as the error of a handler")
+		}
+		if t.isCommaOk(x) {
+			if err := t.declareOkErr(fn, x); err != nil {
+				return nil, err
+			}
+		}
+		body = x.Handler
+		setPos(branch, body.Rbrace)
+	}
+	body.List = append(body.List, branch)
+	if t.branches == nil {
+		t.branches = make(map[*ast.BranchStmt]*ast.BlockStmt)
+	}
+	t.branches[branch] = body
+	return t.newErrCheck(t.genErrCond(x, errVar), body), nil
+}
@@ -0,0 +1,247 @@
+package transpiler
+
+import (
+	"go/types"
+	"strconv"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// A try expression of a map index, a type assertion or a receive checks the
+// ok value of its operand, as in `v, ok := m[k]`, and propagates an error
+// describing the failure when ok is false. The error is made by
+// Options.CommaOkError, or by fmt.Errorf and errors.New.
+
+// isCommaOk reports whether x is a map index, a type assertion or a
+// receive, whose try expressions check the ok value. typeOf returns the
+// type of an expression, or nil if it is not known. An index of an operand
+// of unknown type is taken to be a map index, unless the operand is
+// declared as an array or a slice.
+func isCommaOk(x ast.Expr, typeOf func(ast.Expr) types.Type) bool {
+	switch x := ast.Unparen(x).(type) {
+	case *ast.TypeAssertExpr:
+		return x.Type != nil
+	case *ast.UnaryExpr:
+		return x.Op == token.ARROW
+	case *ast.IndexExpr:
+		if typ := typeOf(x.X); typ != nil {
+			_, isMap := typ.Underlying().(*types.Map)
+			return isMap
+		}
+		ident, ok := ast.Unparen(x.X).(*ast.Ident)
+		if !ok || ident.Obj == nil || ident.Obj.Kind != ast.Var {
+			return true
+		}
+		typ := declaredType(ident.Obj)
+		seen := make(map[*ast.TypeSpec]bool)
+		for typ != nil {
+			switch t := ast.Unparen(typ).(type) {
+			case *ast.ArrayType:
+				return false
+			case *ast.StarExpr:
+				// Pointer to an array.
+				typ = t.X
+			default:
+				spec := typeSpecOf(typ)
+				if spec == nil || seen[spec] {
+					return true
+				}
+				seen[spec] = true
+				typ = spec.Type
+			}
+		}
+		return true
+	}
+	return false
+}
+
+// isCommaOk reports whether x checks the ok value of its operand.
+func (t *transpiler) isCommaOk(x *ast.TryExpr) bool {
+	return isCommaOk(x.X, t.typeOf)
+}
+
+// containsCommaOk reports whether n contains a try expression checking the
+// ok value of its operand, not counting those of function literals.
+func (t *transpiler) containsCommaOk(n ast.Node) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.TryExpr:
+			found = found || t.isCommaOk(x)
+		}
+		return !found
+	})
+	return found
+}
+
+// genOkErr generates the error of the try expression x of fn whose ok
+// value is false, as in
+//
+//	fmt.Errorf("key %q not found", k)
+//	fmt.Errorf("unexpected type %T, want fmt.Stringer", x)
+//	errors.New("receive from closed channel")
+//
+// The key and the value asserted are only mentioned if they are read again
+// safely.
+func (t *transpiler) genOkErr(fn *function, x *ast.TryExpr) ast.Expr {
+	var arg ast.Expr
+	switch op := ast.Unparen(x.X).(type) {
+	case *ast.IndexExpr:
+		if _, isLit := op.Index.(*ast.BasicLit); !isLit && t.readsAgain(fn, op.Index) {
+			arg = op.Index
+		}
+	case *ast.TypeAssertExpr:
+		if t.readsAgain(fn, op.X) {
+			arg = op.X
+		}
+	}
+	errorf := arg != nil || t.okError != nil
+	// text escapes the text of the message for a format.
+	text := func(s string) string {
+		if errorf {
+			return escapeVerbs(s)
+		}
+		return s
+	}
+
+	var msg string
+	switch op := ast.Unparen(x.X).(type) {
+	case *ast.IndexExpr:
+		switch lit, isLit := op.Index.(*ast.BasicLit); {
+		case isLit:
+			msg = text("key " + lit.Value + " not found")
+		case arg == nil:
+			msg = "key not found"
+		case t.isString(arg):
+			msg = "key %q not found"
+		default:
+			msg = "key %v not found"
+		}
+	case *ast.TypeAssertExpr:
+		want := text(typeString(op.Type))
+		msg = "unexpected type, want " + want
+		if arg != nil {
+			msg = "unexpected type %T, want " + want
+		}
+	default:
+		msg = "receive from closed channel"
+	}
+
+	var fun ast.Expr
+	switch {
+	case t.okError != nil:
+		fun = t.okError.expr()
+	case errorf:
+		fun = &ast.SelectorExpr{X: t.pkgIdent("fmt"), Sel: &ast.Ident{Name: "Errorf"}}
+	default:
+		fun = &ast.SelectorExpr{X: t.pkgIdent("errors"), Sel: &ast.Ident{Name: "New"}}
+	}
+	args := []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(msg)}}
+	if arg != nil {
+		args = append(args, cloneNode(arg))
+	}
+	return &ast.CallExpr{Fun: fun, Args: args}
+}
+
+// declareOkErr declares the error the handler of the comma-ok try
+// expression x of fn receives, at the start of the handler, as in
+//
+//	err := fmt.Errorf("key %q not found", k)
+//
+// The hook of a handle statement is called with the error before it is
+// wrapped.
+func (t *transpiler) declareOkErr(fn *function, x *ast.TryExpr) error {
+	if x.Err == nil || x.Err.Name == "_" {
+		return nil
+	}
+	var stmts []ast.Stmt
+	value := t.genOkErr(fn, x)
+	if t.hook != nil && t.isBound(x) {
+		stmts = append(stmts, &ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: x.Err.Name}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{value},
+		}, t.genHook(fn, x, x.Err.Name))
+		value = &ast.Ident{Name: x.Err.Name}
+	}
+	errExpr, err := t.genErrExpr(x, value)
+	if err != nil {
+		return err
+	}
+	if t.isBound(x) {
+		errExpr = t.annotate(fn, x, errExpr)
+	}
+	if len(stmts) == 0 || errExpr != value {
+		tok := token.DEFINE
+		if len(stmts) > 0 {
+			tok = token.ASSIGN
+		}
+		stmts = append(stmts, &ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: x.Err.Name}},
+			Tok: tok,
+			Rhs: []ast.Expr{errExpr},
+		})
+	}
+	for _, s := range stmts {
+		setPos(s, x.Handler.Lbrace)
+	}
+	x.Handler.List = append(stmts, x.Handler.List...)
+	return nil
+}
+
+// readsAgain reports whether the error check of a try expression of fn may
+// read x again: x is a variable or a field of one, which the statement being
+// lowered does not assign.
+func (t *transpiler) readsAgain(fn *function, x ast.Expr) bool {
+	root := x
+	for {
+		sel, ok := root.(*ast.SelectorExpr)
+		if !ok {
+			break
+		}
+		root = sel.X
+	}
+	ident, ok := root.(*ast.Ident)
+	if !ok || ident.Name == "_" || fn.site == nil {
+		return false
+	}
+	assigned := false
+	ast.Inspect(fn.site.list[fn.site.index], func(n ast.Node) bool {
+		var lhs []ast.Expr
+		switch s := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.AssignStmt:
+			lhs = s.Lhs
+		case *ast.RangeStmt:
+			lhs = []ast.Expr{s.Key, s.Value}
+		case *ast.ValueSpec:
+			for _, name := range s.Names {
+				lhs = append(lhs, name)
+			}
+		}
+		for _, x := range lhs {
+			if assignedIdent, ok := x.(*ast.Ident); ok && assignedIdent.Name == ident.Name {
+				assigned = true
+			}
+		}
+		return !assigned
+	})
+	return !assigned
+}
+
+// isString reports whether x is known to be a string.
+func (t *transpiler) isString(x ast.Expr) bool {
+	if typ := t.typeOf(x); typ != nil {
+		return kindOfGo(typ) == stringKind
+	}
+	ident, ok := x.(*ast.Ident)
+	if !ok || ident.Obj == nil {
+		return false
+	}
+	typ := declaredType(ident.Obj)
+	return typ != nil && kindOf(typ) == stringKind
+}
@@ -0,0 +1,146 @@
+package transpiler
+
+import (
+	"slices"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/astutil"
+	"github.com/aisk/ego/token"
+)
+
+// defaultValue is the default value of a default expression lowered to a
+// try expression.
+type defaultValue struct {
+	assign *ast.AssignStmt // the assignment of the handler
+	// Default values assigning the placeholder of assign, as in the default
+	// value of `x ?? y ?? z`, which are lowered first.
+	nested []*defaultValue
+}
+
+// lowerDefaultExprs replaces the default expressions `x ?? y` of the file
+// with try expressions recorded in t.defaults, whose handler assigns y to
+// the variable holding the value of x. The variable is only known when
+// the try expression is lowered, see setDefault, so the handler assigns a
+// placeholder until then. Keeping y in the handler lowers the try
+// expressions of y in it, so that y is only evaluated when x fails.
+func (t *transpiler) lowerDefaultExprs() {
+	astutil.Apply(t.file, nil, func(c *astutil.Cursor) bool {
+		x, ok := c.Node().(*ast.DefaultExpr)
+		if !ok {
+			return true
+		}
+		assign := &ast.AssignStmt{
+			Lhs:    []ast.Expr{&ast.Ident{NamePos: x.OpPos}},
+			TokPos: x.OpPos,
+			Tok:    token.ASSIGN,
+			Rhs:    []ast.Expr{x.Y},
+		}
+		tryX := &ast.TryExpr{
+			X:        x.X,
+			Question: x.OpPos,
+			Handler:  &ast.BlockStmt{Lbrace: x.OpPos, List: []ast.Stmt{assign}, Rbrace: x.End() - 1},
+		}
+		if t.defaults == nil {
+			t.defaults = make(map[*ast.TryExpr]*defaultValue)
+		}
+		t.defaults[tryX] = &defaultValue{assign: assign}
+		c.Replace(tryX)
+		return true
+	})
+}
+
+// setDefault makes the handler of the default expression x assign its
+// default value to v, which holds the value of x.
+func (t *transpiler) setDefault(x *ast.TryExpr, v ast.Expr) {
+	d := t.defaults[x]
+	if d == nil {
+		return
+	}
+	for _, outer := range t.defaults {
+		if outer.assign.Lhs[0] == v {
+			// v is the placeholder of a default value assigned later.
+			outer.nested = append(outer.nested, d)
+			return
+		}
+	}
+	d.assignTo(v)
+}
+
+// assignTo replaces the placeholder of d, and of the default values nested
+// in it, with v.
+func (d *defaultValue) assignTo(v ast.Expr) {
+	target := cloneNode(v)
+	setPos(target, d.assign.TokPos)
+	d.assign.Lhs[0] = target
+	for _, nested := range d.nested {
+		nested.assignTo(v)
+	}
+}
+
+// errVarOf returns the name of the variable holding the error of x in fn:
+// the name the handler of x receives the error under, if it has one. The
+// error of a default expression, `?continue` or `?break` is dropped, so it
+// is not held by the named error result of fn, which deferred functions
+// and bare returns observe. An error of a concrete type has a variable of
+// its own, as a nil one is not a nil error. A comma-ok try expression has
+// an ok variable instead.
+func (t *transpiler) errVarOf(fn *function, x *ast.TryExpr) string {
+	if t.isCommaOk(x) {
+		return fn.okVar
+	}
+	if x.Err != nil {
+		return x.Err.Name
+	}
+	if name, ok := t.errVars[x]; ok {
+		return name
+	}
+	base := t.concreteErrName(x)
+	if base == "" {
+		if (t.defaults[x] == nil && !x.BranchPos.IsValid()) || !fn.errIsResult() {
+			return fn.errVar
+		}
+		base = fn.errVar
+	}
+	if t.errVars == nil {
+		t.errVars = make(map[*ast.TryExpr]string)
+	}
+	t.errVars[x] = t.newName(fn, base)
+	return t.errVars[x]
+}
+
+// dropErrDecls removes the declarations of error variables from the handler
+// body of a default expression whose error is held by errVar in fn. The try
+// expressions of the default value are lowered before the check holding
+// errVar is generated, so they declare the error variables they assign,
+// which shadow errVar, or the error result of fn if it is not. Those of
+// nested default values are removed with the outermost one, whose site is
+// known.
+func (t *transpiler) dropErrDecls(fn *function, body *ast.BlockStmt, errVar string) {
+	var result string
+	if obj := errResult(fn.Type); obj != nil && fn.site != nil {
+		if found, _ := lookup(fn.site.scope, obj.Name); found == obj {
+			result = obj.Name
+		}
+	}
+	drop := func(s ast.Stmt) bool {
+		decl, ok := s.(*ast.DeclStmt)
+		if !ok {
+			return false
+		}
+		name, ok := t.errDecls[decl]
+		return ok && (name == errVar || name == result)
+	}
+	if fn.site == nil {
+		body.List = slices.DeleteFunc(body.List, drop)
+		return
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.BlockStmt:
+			x.List = slices.DeleteFunc(x.List, drop)
+		}
+		return true
+	})
+}
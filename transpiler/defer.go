@@ -0,0 +1,346 @@
+package transpiler
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// nameErrResults names the error results of the functions with `defer?`
+// statements, which set the error result from a deferred function. A
+// function with unnamed results gets its other results named _, and its
+// error result err, or a fresh name if the function mentions err already.
+// The results are named before the file is lowered, so that the try
+// expressions of the function propagate their errors through the error
+// result too.
+func (t *transpiler) nameErrResults() error {
+	var err error
+	ast.Inspect(t.file, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		fn := &function{}
+		switch x := n.(type) {
+		case *ast.FuncDecl:
+			fn.Type, fn.Body = x.Type, x.Body
+		case *ast.FuncLit:
+			fn.Type, fn.Body = x.Type, x.Body
+		default:
+			return true
+		}
+		if s := findDeferTry(fn.Body); s != nil {
+			err = t.nameErrResult(fn, s)
+		}
+		return true
+	})
+	return err
+}
+
+// findDeferTry returns the first `defer?` statement of body, not counting
+// those of function literals, or nil if there is none.
+func findDeferTry(body *ast.BlockStmt) *ast.DeferStmt {
+	var found *ast.DeferStmt
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
+			return false
+		case *ast.DeferStmt:
+			if n.Question.IsValid() && found == nil {
+				found = n
+			}
+		}
+		return found == nil
+	})
+	return found
+}
+
+// nameErrResult names the error result of fn, whose `defer?` statement s
+// sets it.
+func (t *transpiler) nameErrResult(fn *function, s *ast.DeferStmt) error {
+	results := fn.Type.Results
+	if results.NumFields() == 0 {
+		return t.errorf(s.Question, "defer? used in function that does not return an error")
+	}
+	last := results.List[len(results.List)-1]
+	if !isError(last.Type) {
+		return t.errorf(s.Question, "defer? used in function whose last result %s is not error", typeString(last.Type))
+	}
+	if hasNamedResults(fn.Type) && last.Names[len(last.Names)-1].Name != "_" {
+		t.addDeferResult(errResult(fn.Type))
+		return nil
+	}
+
+	name := "err"
+	if mentions(fn.Body, name) || mentions(fn.Type, name) {
+		name = t.newName(fn, name)
+	}
+	ident := &ast.Ident{NamePos: last.Type.Pos(), Name: name, Obj: ast.NewObj(ast.Var, name)}
+	ident.Obj.Decl = last
+	t.addDeferResult(ident.Obj)
+	if hasNamedResults(fn.Type) {
+		last.Names[len(last.Names)-1] = ident
+		return nil
+	}
+	for _, field := range results.List {
+		field.Names = []*ast.Ident{{NamePos: field.Type.Pos(), Name: "_"}}
+	}
+	last.Names = []*ast.Ident{ident}
+	return nil
+}
+
+// addDeferResult records that a `defer?` statement sets the error result
+// obj, which generated declarations must not shadow, see varAt.
+func (t *transpiler) addDeferResult(obj *ast.Object) {
+	if t.deferResults == nil {
+		t.deferResults = make(map[*ast.Object]bool)
+	}
+	t.deferResults[obj] = true
+}
+
+// mentions reports whether an identifier in n is named name.
+func mentions(n ast.Node, name string) bool {
+	found := false
+	ast.Inspect(n, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
+// lowerDefer lowers the `defer?` statement s of fn to a deferred function
+// literal joining the error of the call into the error result, as in
+//
+//	defer func() {
+//		if closeErr := f.Close(); closeErr != nil {
+//			err = errors.Join(err, closeErr)
+//		}
+//	}()
+//
+// With Options.DeferFirstError, the error of the call is only returned if
+// the function succeeded otherwise. The function value and the arguments of
+// the call are evaluated before, see captureCall, and the error of the call
+// is named after base.
+func (t *transpiler) lowerDefer(fn *function, s *ast.DeferStmt, base string) (ast.Stmt, error) {
+	result := errName(fn.Type)
+	if site := findSite(fn, s); site != nil {
+		if obj, _ := lookup(site.scope, result); obj != errResult(fn.Type) {
+			return nil, t.errorf(s.Question, "defer? cannot set the error result %s, which is shadowed here", result)
+		}
+	}
+	callErr := t.newName(fn, base+"Err")
+
+	var cond ast.Expr = &ast.BinaryExpr{
+		X:  &ast.Ident{Name: callErr},
+		Op: token.NEQ,
+		Y:  &ast.Ident{Name: "nil"},
+	}
+	var errExpr ast.Expr = &ast.Ident{Name: callErr}
+	if t.deferFirstError {
+		cond = &ast.BinaryExpr{
+			X:  cond,
+			Op: token.LAND,
+			Y: &ast.BinaryExpr{
+				X:  &ast.Ident{Name: result},
+				Op: token.EQL,
+				Y:  &ast.Ident{Name: "nil"},
+			},
+		}
+	} else {
+		errExpr = &ast.CallExpr{
+			Fun: &ast.SelectorExpr{
+				X:   t.pkgIdent("errors"),
+				Sel: &ast.Ident{Name: "Join"},
+			},
+			Args: []ast.Expr{&ast.Ident{Name: result}, errExpr},
+		}
+	}
+	check := &ast.IfStmt{
+		Init: &ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: callErr}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{s.Call},
+		},
+		Cond: cond,
+		Body: &ast.BlockStmt{List: []ast.Stmt{&ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: result}},
+			Tok: token.ASSIGN,
+			Rhs: []ast.Expr{errExpr},
+		}}},
+	}
+	lit := &ast.FuncLit{
+		Type: &ast.FuncType{Params: &ast.FieldList{}},
+		Body: &ast.BlockStmt{List: []ast.Stmt{check}},
+	}
+	setPos(check, s.Call.Pos())
+	setPos(lit, s.Pos())
+	return &ast.DeferStmt{Defer: s.Defer, Call: &ast.CallExpr{Fun: lit}}, nil
+}
+
+// captureCall returns the statements holding the function value and the
+// arguments of call, the call of a `defer?` statement of fn, in temporaries
+// it then refers to, so that the deferred function literal calls what a
+// defer statement evaluates, as in
+//
+//	closeFunc := f.Close
+//
+// Values that do not change until the function returns are left in place.
+func (t *transpiler) captureCall(fn *function, call *ast.CallExpr) []ast.Stmt {
+	var stmts []ast.Stmt
+	capture := func(x *ast.Expr, base string) {
+		temp := t.newName(fn, base)
+		assign := &ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: temp}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{*x},
+		}
+		setPos(assign, (*x).Pos())
+		stmts = append(stmts, assign)
+		*x = &ast.Ident{NamePos: (*x).Pos(), Name: temp}
+	}
+	switch fun := ast.Unparen(call.Fun).(type) {
+	case *ast.FuncLit:
+	case *ast.SelectorExpr:
+		// A method value binds its receiver.
+		if !t.isPackage(fun.X) && !t.isFixed(fn, fun.X) {
+			capture(&call.Fun, strings.TrimSuffix(baseName(call), "Res")+"Func")
+		}
+	default:
+		if !t.isFixed(fn, fun) {
+			capture(&call.Fun, strings.TrimSuffix(baseName(call), "Res")+"Func")
+		}
+	}
+	for i, arg := range call.Args {
+		if t.isFixed(fn, arg) {
+			continue
+		}
+		base := "arg"
+		switch x := ast.Unparen(arg).(type) {
+		case *ast.Ident:
+			base = x.Name
+		case *ast.CallExpr:
+			base = baseName(x)
+		}
+		capture(&call.Args[i], base)
+	}
+	return stmts
+}
+
+// isPackage reports whether x names a package the file imports.
+func (t *transpiler) isPackage(x ast.Expr) bool {
+	ident, ok := x.(*ast.Ident)
+	if !ok || ident.Obj != nil {
+		return false
+	}
+	for _, spec := range t.file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil && importName(t.file, path) == ident.Name {
+			return true
+		}
+	}
+	return false
+}
+
+// isFixed reports whether x evaluates to the same value until fn returns:
+// a literal, a constant, a function, or a variable of fn that is not
+// assigned after its declaration, nor has its address taken, along with
+// operators applied to them. Variables of fn without objects are the
+// temporaries declared by the transpiler.
+func (t *transpiler) isFixed(fn *function, x ast.Expr) bool {
+	switch x := x.(type) {
+	case *ast.BasicLit, *ast.FuncLit:
+		return true
+	case *ast.ParenExpr:
+		return t.isFixed(fn, x.X)
+	case *ast.UnaryExpr:
+		return x.Op != token.ARROW && t.isFixed(fn, x.X)
+	case *ast.BinaryExpr:
+		return t.isFixed(fn, x.X) && t.isFixed(fn, x.Y)
+	case *ast.Ident:
+		if x.Obj == nil {
+			switch x.Name {
+			case "nil", "true", "false":
+				return true
+			}
+			return definedIn(fn.Body, x.Name) && !assignedIn(fn.Body, x.Name, nil)
+		}
+		switch x.Obj.Kind {
+		case ast.Con, ast.Fun:
+			return true
+		case ast.Var:
+			inFn := x.Obj.Pos() >= fn.Type.Pos() && x.Obj.Pos() < fn.Body.End()
+			return inFn && !assignedIn(fn.Body, x.Name, x.Obj)
+		}
+	}
+	return false
+}
+
+// definedIn reports whether a short variable declaration in body declares
+// a variable named name without an object.
+func definedIn(body *ast.BlockStmt, name string) bool {
+	var found bool
+	ast.Inspect(body, func(n ast.Node) bool {
+		if assign, ok := n.(*ast.AssignStmt); ok && assign.Tok == token.DEFINE {
+			for _, x := range assign.Lhs {
+				if ident, ok := x.(*ast.Ident); ok && ident.Name == name && ident.Obj == nil {
+					found = true
+				}
+			}
+		}
+		return !found
+	})
+	return found
+}
+
+// assignedIn reports whether body assigns the variable obj named name, or a
+// field or an element of it, other than where it is declared, or takes its
+// address. A variable without an object is declared where it is first
+// assigned with :=.
+func assignedIn(body *ast.BlockStmt, name string, obj *ast.Object) bool {
+	declared := obj != nil
+	var found bool
+	// assigns reports whether assigning x assigns the variable.
+	assigns := func(x ast.Expr) bool {
+		for {
+			switch e := x.(type) {
+			case *ast.ParenExpr:
+				x = e.X
+			case *ast.SelectorExpr:
+				x = e.X
+			case *ast.IndexExpr:
+				x = e.X
+			case *ast.Ident:
+				return e.Name == name && e.Obj == obj
+			default:
+				return false
+			}
+		}
+	}
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.AssignStmt:
+			for _, x := range n.Lhs {
+				if !assigns(x) {
+					continue
+				}
+				switch {
+				case obj != nil && obj.Decl == n:
+				case obj == nil && !declared && n.Tok == token.DEFINE:
+					declared = true
+				default:
+					found = true
+				}
+			}
+		case *ast.IncDecStmt:
+			found = found || assigns(n.X)
+		case *ast.RangeStmt:
+			found = found || n.Tok == token.ASSIGN && (n.Key != nil && assigns(n.Key) || n.Value != nil && assigns(n.Value))
+		case *ast.UnaryExpr:
+			found = found || n.Op == token.AND && assigns(n.X)
+		}
+		return !found
+	})
+	return found
+}
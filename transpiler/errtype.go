@@ -0,0 +1,356 @@
+package transpiler
+
+import (
+	"bytes"
+	"fmt"
+	"go/types"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/format"
+	"github.com/aisk/ego/token"
+)
+
+// errKind classifies a type implementing error by how an error value is
+// converted to it.
+type errKind int
+
+const (
+	notErrKind       errKind = iota // does not implement error
+	unknownErrKind                  // declared in another package
+	ifaceErrKind                    // interface, error itself included
+	typeParamErrKind                // type parameter constrained by error
+	concreteErrKind                 // other type with an Error method
+)
+
+// errKindOf determines the kind of the type expression typ. Types declared
+// in the file are checked for an Error method; types of other packages
+// cannot be checked from the source of the file alone, unless it is
+// type-checked.
+func (t *transpiler) errKindOf(typ ast.Expr) errKind {
+	if checked := t.typeOf(typ); checked != nil {
+		return errKindOfGo(checked)
+	}
+	return t.errKindOfType(typ, make(map[*ast.TypeSpec]bool))
+}
+
+func (t *transpiler) errKindOfType(typ ast.Expr, seen map[*ast.TypeSpec]bool) errKind {
+	switch x := typ.(type) {
+	case *ast.ParenExpr:
+		return t.errKindOfType(x.X, seen)
+	case *ast.SelectorExpr:
+		return unknownErrKind
+	case *ast.StarExpr:
+		if _, ok := ast.Unparen(x.X).(*ast.SelectorExpr); ok {
+			return unknownErrKind
+		}
+		if spec := typeSpecOf(x.X); spec != nil && t.hasErrorMethod(spec, true) {
+			return concreteErrKind
+		}
+		return notErrKind
+	case *ast.InterfaceType:
+		if t.ifaceHasError(x, seen) {
+			return ifaceErrKind
+		}
+		return notErrKind
+	}
+
+	ident, ok := baseType(typ).(*ast.Ident)
+	if !ok {
+		return notErrKind
+	}
+	if ident.Obj == nil {
+		if ident.Name == "error" {
+			return ifaceErrKind
+		}
+		return notErrKind
+	}
+	switch decl := ident.Obj.Decl.(type) {
+	case *ast.Field:
+		// Type parameter.
+		if ident.Obj.Kind != ast.Typ {
+			break
+		}
+		if k := t.errKindOfType(decl.Type, seen); k == ifaceErrKind || k == unknownErrKind {
+			return typeParamErrKind
+		}
+	case *ast.TypeSpec:
+		if seen[decl] {
+			return notErrKind
+		}
+		seen[decl] = true
+		if iface, ok := decl.Type.(*ast.InterfaceType); ok {
+			return t.errKindOfType(iface, seen)
+		}
+		if t.hasErrorMethod(decl, false) {
+			return concreteErrKind
+		}
+	}
+	return notErrKind
+}
+
+// ifaceHasError reports whether the interface iface has the Error method of
+// error, declared or embedded.
+func (t *transpiler) ifaceHasError(iface *ast.InterfaceType, seen map[*ast.TypeSpec]bool) bool {
+	for _, field := range iface.Methods.List {
+		if len(field.Names) == 0 {
+			if t.errKindOfType(field.Type, seen) == ifaceErrKind {
+				return true
+			}
+			continue
+		}
+		for _, name := range field.Names {
+			if ftype, ok := field.Type.(*ast.FuncType); ok && name.Name == "Error" && isErrorMethod(ftype) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// hasErrorMethod reports whether the file declares the Error method of
+// error for the type of spec, or for a pointer to it if pointer is set.
+func (t *transpiler) hasErrorMethod(spec *ast.TypeSpec, pointer bool) bool {
+	for _, decl := range t.file.Decls {
+		fn, ok := decl.(*ast.FuncDecl)
+		if !ok || fn.Recv == nil || len(fn.Recv.List) != 1 || fn.Name.Name != "Error" || !isErrorMethod(fn.Type) {
+			continue
+		}
+		recv := fn.Recv.List[0].Type
+		star, isPointer := recv.(*ast.StarExpr)
+		if isPointer {
+			if !pointer {
+				continue
+			}
+			recv = star.X
+		}
+		if typeSpecOf(recv) == spec {
+			return true
+		}
+	}
+	return false
+}
+
+// isErrorMethod reports whether ftype is the signature of the Error method.
+func isErrorMethod(ftype *ast.FuncType) bool {
+	if ftype.Params.NumFields() != 0 || ftype.Results.NumFields() != 1 {
+		return false
+	}
+	ident, ok := ftype.Results.List[0].Type.(*ast.Ident)
+	return ok && ident.Name == "string" && ident.Obj == nil
+}
+
+// baseType returns the generic type of an instantiated type expression, and
+// typ itself otherwise.
+func baseType(typ ast.Expr) ast.Expr {
+	switch x := ast.Unparen(typ).(type) {
+	case *ast.IndexExpr:
+		return x.X
+	case *ast.IndexListExpr:
+		return x.X
+	}
+	return ast.Unparen(typ)
+}
+
+// typeSpecOf returns the declaration of the type named by typ in the file,
+// or nil.
+func typeSpecOf(typ ast.Expr) *ast.TypeSpec {
+	ident, ok := baseType(typ).(*ast.Ident)
+	if !ok || ident.Obj == nil || ident.Obj.Kind != ast.Typ {
+		return nil
+	}
+	spec, _ := ident.Obj.Decl.(*ast.TypeSpec)
+	return spec
+}
+
+// errResultType returns the type of the error result of ftype, which is its
+// last result.
+func (t *transpiler) errResultType(ftype *ast.FuncType) (ast.Expr, error) {
+	if ftype.Results.NumFields() == 0 {
+		return nil, fmt.Errorf("try expression used in function that does not return an error")
+	}
+	fields := ftype.Results.List
+	typ := fields[len(fields)-1].Type
+	switch t.errKindOf(typ) {
+	case notErrKind:
+		return nil, fmt.Errorf("try expression used in function whose last result %s does not implement error", typeString(typ))
+	case unknownErrKind:
+		return nil, fmt.Errorf("cannot tell whether %s implements error without type information", typeString(typ))
+	}
+	return typ, nil
+}
+
+// calleeErrType returns the type of the error propagated by x, which is the
+// last value of its operand, or nil if it is not known. Without type
+// information, only the results of functions declared in the file are
+// known.
+func (t *transpiler) calleeErrType(x *ast.TryExpr) ast.Expr {
+	if values := t.tryValues(x); values != nil {
+		return t.typeExpr(values[len(values)-1])
+	}
+	call, ok := ast.Unparen(x.X).(*ast.CallExpr)
+	if !ok {
+		return nil
+	}
+	ident, ok := baseType(call.Fun).(*ast.Ident)
+	if !ok || ident.Obj == nil || ident.Obj.Kind != ast.Fun {
+		return nil
+	}
+	decl, ok := ident.Obj.Decl.(*ast.FuncDecl)
+	if !ok || decl.Type.Results.NumFields() == 0 {
+		return nil
+	}
+	fields := decl.Type.Results.List
+	return fields[len(fields)-1].Type
+}
+
+// concreteErrName returns the name of a variable holding the error
+// propagated by x, as myError for *MyError, or "" if the error is not known
+// to be of a concrete type.
+func (t *transpiler) concreteErrName(x *ast.TryExpr) string {
+	if values := t.tryValues(x); values != nil {
+		typ := values[len(values)-1]
+		if types.IsInterface(typ) {
+			return ""
+		}
+		if ptr, ok := typ.(*types.Pointer); ok {
+			typ = ptr.Elem()
+		}
+		if named, ok := types.Unalias(typ).(*types.Named); ok {
+			return errVarName(named.Obj().Name())
+		}
+		return "err"
+	}
+	typ := t.calleeErrType(x)
+	if typ == nil {
+		return ""
+	}
+	if _, pointer := ast.Unparen(typ).(*ast.StarExpr); !pointer && t.errKindOf(typ) != concreteErrKind {
+		return ""
+	}
+	return errVarName(typeName(typ))
+}
+
+// convertErr converts errExpr, the error propagated by x, to the type typ of
+// the error result. An error that may be of another type is asserted to
+// typ, see genAssertedReturn, which requires a fallback.
+func (t *transpiler) convertErr(x *ast.TryExpr, errExpr ast.Expr, typ ast.Expr) (ast.Expr, error) {
+	kind := t.errKindOf(typ)
+	if kind == ifaceErrKind && isError(typ) {
+		return errExpr, nil
+	}
+
+	var srcKind errKind
+	var srcName string
+	same := false
+	// A wrapped error and the error of a comma-ok try expression are made
+	// by the try expression.
+	made := len(x.Args) > 0 || t.isCommaOk(x)
+	if !made {
+		if values := t.tryValues(x); values != nil {
+			srcType := values[len(values)-1]
+			srcKind = errKindOfGo(srcType)
+			dst := t.typeOf(typ)
+			same = dst != nil && types.Identical(srcType, dst)
+			srcName = types.TypeString(srcType, (*types.Package).Name)
+		} else if src := t.calleeErrType(x); src != nil {
+			srcKind = t.errKindOf(src)
+			srcName = typeString(src)
+			same = srcName == typeString(typ)
+		}
+	}
+	if same {
+		return errExpr, nil
+	}
+	assert := &ast.TypeAssertExpr{X: errExpr, Type: cloneNode(typ)}
+	if srcName == "" || srcKind == ifaceErrKind {
+		if made && kind == concreteErrKind {
+			if t.isCommaOk(x) {
+				return nil, t.errorf(x.Pos(), "comma-ok error cannot be returned as %s", typeString(typ))
+			}
+			return nil, t.errorf(x.Pos(), "wrapped error cannot be returned as %s", typeString(typ))
+		}
+		if t.fallback == FallbackNone {
+			if srcName == "" {
+				srcName = "unknown type"
+			} else {
+				srcName = "type " + srcName
+			}
+			return nil, t.errorf(x.Pos(), "cannot return error of %s as %s without a fallback", srcName, typeString(typ))
+		}
+		return assert, nil
+	}
+	switch kind {
+	case ifaceErrKind:
+		return errExpr, nil
+	case typeParamErrKind:
+		if t.fallback == FallbackNone {
+			return nil, t.errorf(x.Pos(), "cannot return error of type %s as %s without a fallback", srcName, typeString(typ))
+		}
+		assert.X = &ast.CallExpr{Fun: &ast.Ident{Name: "any"}, Args: []ast.Expr{errExpr}}
+		return assert, nil
+	}
+	return nil, t.errorf(x.Pos(), "cannot return error of type %s as %s", srcName, typeString(typ))
+}
+
+// genAssertedReturn generates the statements returning the error errExpr of
+// x from fn, asserted by assert to the type of the error result. An error of
+// another type is passed to the fallback function of fn, as in
+//
+//	if parseError, ok := err.(*ParseError); ok {
+//		return 0, parseError
+//	}
+//	panic(err)
+func (t *transpiler) genAssertedReturn(fn *function, errExpr ast.Expr, assert *ast.TypeAssertExpr) []ast.Stmt {
+	name := t.newName(fn, errVarName(typeName(assert.Type)))
+	ok := t.newName(fn, "ok")
+	check := &ast.IfStmt{
+		Init: &ast.AssignStmt{
+			Lhs: []ast.Expr{&ast.Ident{Name: name}, &ast.Ident{Name: ok}},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{assert},
+		},
+		Cond: &ast.Ident{Name: ok},
+		Body: &ast.BlockStmt{List: []ast.Stmt{
+			&ast.ReturnStmt{Results: t.genResults(fn.Type.Results, &ast.Ident{Name: name})},
+		}},
+	}
+	return []ast.Stmt{check, t.genFallback(fn, errExpr)}
+}
+
+// typeName returns the name of the type typ, or of the type it points to,
+// or "" if it has none.
+func typeName(typ ast.Expr) string {
+	if star, ok := ast.Unparen(typ).(*ast.StarExpr); ok {
+		typ = star.X
+	}
+	switch typ := baseType(typ).(type) {
+	case *ast.Ident:
+		return typ.Name
+	case *ast.SelectorExpr:
+		return typ.Sel.Name
+	}
+	return ""
+}
+
+// errVarName returns the name of a variable holding an error of the type
+// named name, as myError for MyError. The name of an unexported type is
+// not taken, so it is err then.
+func errVarName(name string) string {
+	if lower := lowerFirst(name); lower != name && !token.IsKeyword(lower) && !predeclared[lower] {
+		return lower
+	}
+	return "err"
+}
+
+// isError reports whether typ is the predeclared type error.
+func isError(typ ast.Expr) bool {
+	ident, ok := ast.Unparen(typ).(*ast.Ident)
+	return ok && ident.Name == "error" && ident.Obj == nil
+}
+
+// typeString returns the source of the type expression typ.
+func typeString(typ ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, token.NewFileSet(), cloneNode(typ))
+	return buf.String()
+}
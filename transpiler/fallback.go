@@ -0,0 +1,216 @@
+package transpiler
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/parser"
+)
+
+// Fallback chooses how a try expression is lowered in a function without an
+// error result, where the error cannot be returned.
+type Fallback string
+
+const (
+	// FallbackNone reports try expressions in functions without an error
+	// result as errors.
+	FallbackNone Fallback = "none"
+	// FallbackFatal calls t.Fatal(err) when a *testing.T, *testing.B or
+	// testing.TB parameter is in scope, log.Fatal(err) or the fatal
+	// handler in main, and panic(err) elsewhere.
+	FallbackFatal Fallback = "fatal"
+	// FallbackPanic calls panic(err).
+	FallbackPanic Fallback = "panic"
+)
+
+// fallbackDirective is the prefix of the comment choosing the fallback of a
+// file, as in
+//
+//	//ego:fallback fatal
+//	//ego:fallback fatal exit
+//
+// where the optional last word is the fatal handler.
+const fallbackDirective = "//ego:fallback"
+
+// parseFallback parses the fallback and the optional fatal handler of a
+// fallback directive or option.
+func parseFallback(s string) (Fallback, ast.Expr, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 || len(fields) > 2 {
+		return "", nil, fmt.Errorf("invalid fallback %q", s)
+	}
+	fallback := Fallback(fields[0])
+	switch fallback {
+	case FallbackNone, FallbackFatal, FallbackPanic:
+	default:
+		return "", nil, fmt.Errorf("unknown fallback %q, want %s, %s or %s", fields[0], FallbackNone, FallbackFatal, FallbackPanic)
+	}
+	if len(fields) == 1 {
+		return fallback, nil, nil
+	}
+	if fallback != FallbackFatal {
+		return "", nil, fmt.Errorf("fatal handler %s given for fallback %s", fields[1], fallback)
+	}
+	handler, err := parser.ParseExpr(fields[1])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid fatal handler %q", fields[1])
+	}
+	return fallback, handler, nil
+}
+
+// setFallback chooses the fallback of the file from opts, unless the file
+// has a fallback directive, which is removed.
+func (t *transpiler) setFallback(opts Options) error {
+	t.fallback = FallbackNone
+	if opts.Fallback != "" {
+		t.fallback = opts.Fallback
+	}
+	if opts.FatalHandler != "" {
+		handler, err := parser.ParseExpr(opts.FatalHandler)
+		if err != nil {
+			return fmt.Errorf("invalid fatal handler %q", opts.FatalHandler)
+		}
+		t.fatalHandler = handler
+	}
+	if _, _, err := parseFallback(string(t.fallback)); err != nil {
+		return err
+	}
+
+	var groups []*ast.CommentGroup
+	for _, group := range t.file.Comments {
+		var list []*ast.Comment
+		for _, c := range group.List {
+			arg, ok := strings.CutPrefix(c.Text, fallbackDirective)
+			if !ok || arg != "" && arg[0] != ' ' && arg[0] != '\t' {
+				list = append(list, c)
+				continue
+			}
+			fallback, handler, err := parseFallback(arg)
+			if err != nil {
+				return t.errorf(c.Pos(), "%v", err)
+			}
+			t.fallback = fallback
+			if handler != nil {
+				t.fatalHandler = handler
+			}
+		}
+		if len(list) > 0 {
+			group.List = list
+			groups = append(groups, group)
+		}
+	}
+	t.file.Comments = groups
+	return nil
+}
+
+// hasErrResult reports whether the last result of ftype may implement
+// error, so that errors are returned from a function of type ftype.
+func (t *transpiler) hasErrResult(ftype *ast.FuncType) bool {
+	if ftype.Results.NumFields() == 0 {
+		return false
+	}
+	fields := ftype.Results.List
+	return t.errKindOf(fields[len(fields)-1].Type) != notErrKind
+}
+
+// fallbackFunc returns the function called with the error propagated from
+// fn, which has no error result, or nil if errors are not propagated from
+// functions without an error result.
+func (t *transpiler) fallbackFunc(fn *function) ast.Expr {
+	switch t.fallback {
+	case FallbackFatal:
+		if tb := testingParam(t.file, fn); tb != "" {
+			return &ast.SelectorExpr{X: &ast.Ident{Name: tb}, Sel: &ast.Ident{Name: "Fatal"}}
+		}
+		if fn.decl != nil && fn.decl.Recv == nil && fn.decl.Name.Name == "main" && t.file.Name.Name == "main" {
+			if t.fatalHandler != nil {
+				return cloneNode(t.fatalHandler)
+			}
+			return &ast.SelectorExpr{X: t.pkgIdent("log"), Sel: &ast.Ident{Name: "Fatal"}}
+		}
+		fallthrough
+	case FallbackPanic:
+		return &ast.Ident{Name: "panic"}
+	}
+	return nil
+}
+
+// testingParam returns the name of a *testing.T, *testing.B or testing.TB
+// parameter of fn or of a function enclosing it, or "" if there is none.
+// t.Fatal must be called from the goroutine running the test, so functions
+// run by go statements end the search.
+func testingParam(file *ast.File, fn *function) string {
+	pkg := importName(file, "testing")
+	if pkg == "" {
+		return ""
+	}
+	for ; fn != nil; fn = fn.outer {
+		for _, field := range fn.Type.Params.List {
+			if !isTestingType(field.Type, pkg) {
+				continue
+			}
+			for _, name := range field.Names {
+				if name.Name != "_" {
+					return name.Name
+				}
+			}
+		}
+		if fn.goroutine {
+			break
+		}
+	}
+	return ""
+}
+
+// isTestingType reports whether typ is *testing.T, *testing.B or
+// testing.TB, where the testing package is imported as pkg.
+func isTestingType(typ ast.Expr, pkg string) bool {
+	want := []string{"TB"}
+	if star, ok := typ.(*ast.StarExpr); ok {
+		typ = star.X
+		want = []string{"T", "B"}
+	}
+	sel, ok := typ.(*ast.SelectorExpr)
+	if !ok {
+		return false
+	}
+	x, ok := sel.X.(*ast.Ident)
+	if !ok || x.Name != pkg || x.Obj != nil {
+		return false
+	}
+	for _, name := range want {
+		if sel.Sel.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// importName returns the name file imports the package path as, or "" if it
+// does not import it by name.
+func importName(file *ast.File, path string) string {
+	for _, spec := range file.Imports {
+		if p, err := strconv.Unquote(spec.Path.Value); err != nil || p != path {
+			continue
+		}
+		if spec.Name == nil {
+			return path[strings.LastIndex(path, "/")+1:]
+		}
+		if spec.Name.Name != "_" && spec.Name.Name != "." {
+			return spec.Name.Name
+		}
+	}
+	return ""
+}
+
+// genFallback generates the statement passing errExpr to the fallback
+// function of fn, or returns nil if errors cannot be propagated from fn.
+func (t *transpiler) genFallback(fn *function, errExpr ast.Expr) ast.Stmt {
+	fun := t.fallbackFunc(fn)
+	if fun == nil {
+		return nil
+	}
+	return &ast.ExprStmt{X: &ast.CallExpr{Fun: fun, Args: []ast.Expr{errExpr}}}
+}
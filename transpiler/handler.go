@@ -0,0 +1,462 @@
+package transpiler
+
+import (
+	"reflect"
+	"slices"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// checkPos returns the position of the error check of x. The statements of
+// a handler keep their positions, so its check starts at its brace.
+func checkPos(x *ast.TryExpr) token.Pos {
+	if x.Handler != nil {
+		return x.Handler.Lbrace
+	}
+	return x.End()
+}
+
+// checkHandler reports an error if the handler body receiving the error
+// err may fall through to the code following the try expression, which
+// expects its values.
+func (t *transpiler) checkHandler(err *ast.Ident, body *ast.BlockStmt) error {
+	if err.Name == "_" {
+		return t.errorf(err.Pos(), "cannot use _ as the error of a handler")
+	}
+	if !isTerminating(body) {
+		return t.errorf(body.Rbrace, "missing return at end of error handler")
+	}
+	return nil
+}
+
+// bindHandlers removes the handle statements of the file. The try
+// expressions following a handle statement in its block, or in blocks
+// nested in it, get a copy of its handler, unless they have a handler of
+// their own or are must expressions. Function literals do not inherit the
+// handlers of the functions enclosing them.
+func (t *transpiler) bindHandlers() error {
+	return t.bindHandler(t.file, nil)
+}
+
+// bindHandler binds the try expressions in n to the handle statement h, or
+// to the handle statements declared in the blocks of n.
+func (t *transpiler) bindHandler(n ast.Node, h *ast.HandleStmt) error {
+	var err error
+	ast.Inspect(n, func(n ast.Node) bool {
+		if err != nil {
+			return false
+		}
+		switch x := n.(type) {
+		case *ast.FuncLit:
+			err = t.bindHandler(x.Body, nil)
+			return false
+		case *ast.BlockStmt:
+			x.List, err = t.bindStmts(x.List, h, x.Lbrace)
+			return false
+		case *ast.CaseClause:
+			for _, e := range x.List {
+				if err = t.bindHandler(e, h); err != nil {
+					return false
+				}
+			}
+			x.Body, err = t.bindStmts(x.Body, h, x.Colon)
+			return false
+		case *ast.CommClause:
+			if x.Comm != nil {
+				if err = t.bindHandler(x.Comm, h); err != nil {
+					return false
+				}
+			}
+			x.Body, err = t.bindStmts(x.Body, h, x.Colon)
+			return false
+		case *ast.HandleStmt:
+			// Handle statements in statement lists are removed above.
+			err = t.errorf(x.Pos(), "misplaced handle statement")
+			return false
+		case *ast.TryExpr:
+			if h == nil || x.Handler != nil || x.BranchPos.IsValid() || t.musts[x] {
+				break
+			}
+			// Bind the operand first, as the handler may contain try
+			// expressions bound to the same statement.
+			if err = t.bindHandler(x.X, h); err != nil {
+				return false
+			}
+			for _, arg := range x.Args {
+				if err = t.bindHandler(arg, h); err != nil {
+					return false
+				}
+			}
+			// The handler is checked where the try expression ends, at its
+			// last character, which no code follows.
+			pos := x.End() - 1
+			x.Err = &ast.Ident{NamePos: pos, Name: h.Err.Name}
+			x.Handler = t.cloneHandler(h.Body, pos)
+			return false
+		}
+		return true
+	})
+	return err
+}
+
+// bindStmts binds the try expressions of list to the handle statement h,
+// or to the last handle statement of list before them, and returns list
+// without its handle statements. The list starts after the position start.
+func (t *transpiler) bindStmts(list []ast.Stmt, h *ast.HandleStmt, start token.Pos) ([]ast.Stmt, error) {
+	stmts := list[:0]
+	prev := start
+	for _, s := range list {
+		hs, ok := s.(*ast.HandleStmt)
+		if !ok {
+			if err := t.bindHandler(s, h); err != nil {
+				return nil, err
+			}
+			stmts = append(stmts, s)
+			prev = s.End()
+			continue
+		}
+		if err := t.checkHandler(hs.Err, hs.Body); err != nil {
+			return nil, err
+		}
+		t.addHandler(hs.Body)
+		// The try expressions of a handler are handled by the handler
+		// in effect where it is declared.
+		if err := t.bindHandler(hs.Body, h); err != nil {
+			return nil, err
+		}
+		t.removeStmt(hs, prev)
+		h = hs
+	}
+	return stmts, nil
+}
+
+// handlerSource is the layout of the body of a handle statement, which its
+// copies are printed with.
+type handlerSource struct {
+	body     *ast.BlockStmt
+	lines    []token.Pos // the lines starting in the body
+	comments []*ast.CommentGroup
+}
+
+// handlerCopy is a copy of the body of a handle statement. Until the file
+// is printed, the positions of the copy are all at.
+type handlerCopy struct {
+	src    *handlerSource
+	body   *ast.BlockStmt // the copy
+	at     token.Pos
+	atEnd  bool                     // whether at is the end of a line
+	layout map[*token.Pos]token.Pos // the positions of the copy in src
+}
+
+// addHandler records the layout of the body of a handle statement before
+// its lines and comments are removed from the file.
+func (t *transpiler) addHandler(body *ast.BlockStmt) {
+	src := &handlerSource{body: body}
+	f := t.fset.File(body.Pos())
+	for line := f.Line(body.Lbrace) + 1; line <= f.Line(body.Rbrace); line++ {
+		src.lines = append(src.lines, f.LineStart(line))
+	}
+	for _, g := range t.file.Comments {
+		if g.Pos() > body.Lbrace && g.End() <= body.Rbrace {
+			src.comments = append(src.comments, g)
+		}
+	}
+	if t.handlers == nil {
+		t.handlers = make(map[*ast.BlockStmt]*handlerSource)
+	}
+	t.handlers[body] = src
+}
+
+// cloneHandler returns a copy of the handler body at pos. The must and
+// default expressions in it stay lowered in the copy.
+func (t *transpiler) cloneHandler(body *ast.BlockStmt, pos token.Pos) *ast.BlockStmt {
+	layout := make(map[*token.Pos]token.Pos)
+	clone := cloneValue(reflect.ValueOf(body), pos, layout).Interface().(*ast.BlockStmt)
+	if t.handlerCopies == nil {
+		t.handlerCopies = make(map[*ast.BlockStmt]*handlerCopy)
+	}
+	t.handlerCopies[clone] = &handlerCopy{src: t.handlers[body], body: clone, at: pos, layout: layout}
+	tries, clones := tryExprs(body), tryExprs(clone)
+	for i, x := range tries {
+		if t.musts[x] {
+			t.musts[clones[i]] = true
+		}
+		if t.defaults[x] != nil {
+			assign := clones[i].Handler.List[0].(*ast.AssignStmt)
+			t.defaults[clones[i]] = &defaultValue{assign: assign}
+		}
+	}
+	return clone
+}
+
+// isBound reports whether x is bound to a handle statement, whose handler
+// handles the errors x propagates, rather than having a handler of its own.
+func (t *transpiler) isBound(x *ast.TryExpr) bool {
+	return x.Handler != nil && t.handlerCopies[x.Handler] != nil
+}
+
+// moveHandler moves the copy of a handle statement x is bound to, along
+// with the code generated in it, to the end of the line, after any trailing
+// comment, and reports the position it was at, where x ends.
+func (t *transpiler) moveHandler(x *ast.TryExpr) (token.Pos, bool) {
+	c := t.handlerCopies[x.Handler]
+	if c == nil {
+		return token.NoPos, false
+	}
+	end, pos := c.at, lineEnd(t.fset, c.at)
+	walkPos(x.Handler, func(p *token.Pos) {
+		if *p == end {
+			*p = pos
+		}
+	})
+	c.at, c.atEnd = pos, true
+	return end, true
+}
+
+// tryExprs returns the try expressions in n, in depth-first order.
+func tryExprs(n ast.Node) []*ast.TryExpr {
+	var tries []*ast.TryExpr
+	ast.Inspect(n, func(n ast.Node) bool {
+		if x, ok := n.(*ast.TryExpr); ok {
+			tries = append(tries, x)
+		}
+		return true
+	})
+	return tries
+}
+
+// removeStmt removes the comments of the statement s, which is removed from
+// the file, up to the end of its last line. Unless s shares a line with
+// the end of the preceding code at prev, the lines of s are merged into the
+// line before once transpiled, see mergeLines, so that s leaves no blank
+// lines behind.
+func (t *transpiler) removeStmt(s ast.Stmt, prev token.Pos) {
+	end := lineEnd(t.fset, s.End())
+	t.file.Comments = slices.DeleteFunc(t.file.Comments, func(g *ast.CommentGroup) bool {
+		return g.Pos() >= s.Pos() && g.Pos() < end
+	})
+	f := t.fset.File(s.Pos())
+	if line := f.Line(s.Pos()); line > f.Line(prev) {
+		t.mergedLines = append(t.mergedLines, mergedLines{line - 1, f.Line(s.End()) - line + 1})
+	}
+}
+
+// mergedLines are lines of removed statements, merged into the line before.
+type mergedLines struct {
+	line int // the line before the statement
+	n    int // the number of lines of the statement
+}
+
+// mergeLines merges the lines of the statements removed from the file.
+// The lines keep their numbers until the file is transpiled, so that errors
+// refer to the source.
+func (t *transpiler) mergeLines() {
+	f := t.fset.File(t.file.Pos())
+	// Merging lines renumbers the lines after them.
+	slices.SortFunc(t.mergedLines, func(a, b mergedLines) int { return b.line - a.line })
+	for _, m := range t.mergedLines {
+		for range m.n {
+			f.MergeLine(m.line)
+		}
+	}
+}
+
+// layoutHandlers lays out the copies of the bodies of handle statements in
+// the file like the bodies, with their comments, which the printer places
+// by their positions. The file moves to a new token.File with room for each
+// copy at the position it is at, before any code following there. A copy
+// in the middle of a line stays on the line, so that the code following it
+// there does too.
+func (t *transpiler) layoutHandlers() {
+	var copies []*handlerCopy
+	ast.Inspect(t.file, func(n ast.Node) bool {
+		if body, ok := n.(*ast.BlockStmt); ok && t.handlerCopies[body] != nil {
+			copies = append(copies, t.handlerCopies[body])
+		}
+		return true
+	})
+	if len(copies) == 0 {
+		return
+	}
+	slices.SortStableFunc(copies, func(a, b *handlerCopy) int { return int(a.at - b.at) })
+
+	f := t.fset.File(t.file.Pos())
+	base := token.Pos(f.Base())
+	// shifts[i] is the room made for the copies before copies[i].
+	shifts := make([]int, len(copies)+1)
+	for i, c := range copies {
+		shifts[i+1] = shifts[i] + int(c.src.body.End()-c.src.body.Pos())
+	}
+	// moved returns the offset in the new file of the offset o.
+	moved := func(o int) int {
+		i, _ := slices.BinarySearchFunc(copies, o, func(c *handlerCopy, o int) int {
+			return int(c.at-base) - o
+		})
+		return o + shifts[i]
+	}
+	nf := t.fset.AddFile(f.Name(), -1, f.Size()+shifts[len(copies)])
+	// laidOut returns the position in the new file of pos in the body of
+	// copies[i].
+	laidOut := func(i int, pos token.Pos) token.Pos {
+		return nf.Pos(int(copies[i].at-base) + shifts[i] + int(pos-copies[i].src.body.Pos()))
+	}
+	var lines []int
+	for _, line := range f.Lines() {
+		lines = append(lines, moved(line))
+	}
+	for i, c := range copies {
+		if c.atEnd {
+			for _, line := range c.src.lines {
+				lines = append(lines, nf.Offset(laidOut(i, line)))
+			}
+		}
+	}
+	slices.Sort(lines)
+	nf.SetLines(slices.Compact(lines))
+
+	// The positions of a copy not moved since it was made are laid out
+	// like the body, and the code generated in it is placed with the code
+	// following it; the others move with the file.
+	inCopy := make(map[*token.Pos]token.Pos)
+	for i, c := range copies {
+		var generated []*token.Pos
+		last := laidOut(i, c.src.body.Lbrace)
+		walkPos(c.body, func(p *token.Pos) {
+			if *p != c.at {
+				return
+			}
+			pos, ok := c.layout[p]
+			if !ok {
+				generated = append(generated, p)
+				return
+			}
+			last = laidOut(i, pos)
+			inCopy[p] = last
+			for _, p := range generated {
+				inCopy[p] = last
+			}
+			generated = generated[:0]
+		})
+		for _, p := range generated {
+			inCopy[p] = last
+		}
+	}
+	walkPos(t.file, func(p *token.Pos) {
+		if pos, ok := inCopy[p]; ok {
+			*p = pos
+		} else if p.IsValid() && int(*p) >= f.Base() && int(*p) <= f.Base()+f.Size() {
+			*p = nf.Pos(moved(int(*p - base)))
+		}
+	})
+	for i, c := range copies {
+		for _, g := range c.src.comments {
+			clone := &ast.CommentGroup{}
+			for _, comment := range g.List {
+				clone.List = append(clone.List, &ast.Comment{Slash: laidOut(i, comment.Slash), Text: comment.Text})
+			}
+			t.file.Comments = append(t.file.Comments, clone)
+		}
+	}
+	slices.SortStableFunc(t.file.Comments, func(a, b *ast.CommentGroup) int { return int(a.Pos() - b.Pos()) })
+}
+
+// isTerminating reports whether s is a terminating statement, as defined
+// by the Go specification, or a break, continue or call known not to
+// return, so that control does not flow past s.
+func isTerminating(s ast.Stmt) bool {
+	switch s := s.(type) {
+	case *ast.ReturnStmt:
+		return true
+	case *ast.BranchStmt:
+		return s.Tok != token.FALLTHROUGH
+	case *ast.ExprStmt:
+		call, ok := ast.Unparen(s.X).(*ast.CallExpr)
+		return ok && isNoReturnCall(call)
+	case *ast.BlockStmt:
+		return len(s.List) > 0 && isTerminating(s.List[len(s.List)-1])
+	case *ast.LabeledStmt:
+		return isTerminating(s.Stmt)
+	case *ast.IfStmt:
+		return s.Else != nil && isTerminating(s.Body) && isTerminating(s.Else)
+	case *ast.ForStmt:
+		return s.Cond == nil && !hasBreak(s.Body)
+	case *ast.SwitchStmt:
+		return clausesTerminate(s.Body)
+	case *ast.TypeSwitchStmt:
+		return clausesTerminate(s.Body)
+	case *ast.SelectStmt:
+		return clausesTerminate(s.Body)
+	}
+	return false
+}
+
+// isNoReturnCall reports whether call is a call of panic, os.Exit,
+// runtime.Goexit or a Fatal or FailNow function or method, which do not
+// return.
+func isNoReturnCall(call *ast.CallExpr) bool {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun.Name == "panic" && fun.Obj == nil
+	case *ast.SelectorExpr:
+		switch fun.Sel.Name {
+		case "Exit", "Goexit", "Fatal", "Fatalf", "Fatalln", "FailNow":
+			return true
+		}
+	}
+	return false
+}
+
+// clausesTerminate reports whether the clauses of a switch or select
+// statement with body all end in terminating statements without breaking
+// out of it, and a switch has a default clause.
+func clausesTerminate(body *ast.BlockStmt) bool {
+	hasDefault := false
+	for _, clause := range body.List {
+		var list []ast.Stmt
+		switch clause := clause.(type) {
+		case *ast.CaseClause:
+			hasDefault = hasDefault || clause.List == nil
+			list = clause.Body
+		case *ast.CommClause:
+			hasDefault = true
+			list = clause.Body
+		}
+		if len(list) == 0 || hasBreak(&ast.BlockStmt{List: list}) {
+			return false
+		}
+		last := list[len(list)-1]
+		if branch, ok := last.(*ast.BranchStmt); !isTerminating(last) && (!ok || branch.Tok != token.FALLTHROUGH) {
+			return false
+		}
+	}
+	return hasDefault
+}
+
+// hasBreak reports whether body has an unlabeled break statement breaking
+// out of the statement body belongs to, or a labeled one.
+func hasBreak(body *ast.BlockStmt) bool {
+	found := false
+	ast.Inspect(body, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.BranchStmt:
+			if n.Tok == token.BREAK {
+				found = true
+			}
+		case *ast.ForStmt, *ast.RangeStmt, *ast.SwitchStmt, *ast.TypeSwitchStmt, *ast.SelectStmt:
+			// Unlabeled breaks in nested statements break out of them;
+			// labeled ones are reported below.
+			ast.Inspect(n, func(n ast.Node) bool {
+				if branch, ok := n.(*ast.BranchStmt); ok && branch.Tok == token.BREAK && branch.Label != nil {
+					found = true
+				}
+				return !found
+			})
+			return false
+		case *ast.FuncLit:
+			return false
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,109 @@
+package transpiler
+
+import (
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/astutil"
+	"github.com/aisk/ego/token"
+)
+
+// funcRef is a function named by an option, as the hook called before a
+// try expression propagates an error, see Options.Hook and
+// Options.CommaOkError.
+type funcRef struct {
+	fun  string // name of the function
+	path string // import path of its package, or "" for the file's package
+	name string // name of its package
+	used bool   // whether the file calls the function
+}
+
+// parseFuncRef parses the value s of the option named option, of the form
+// [name=]path.Func or Func.
+func parseFuncRef(option, s string) (*funcRef, error) {
+	h := &funcRef{}
+	name, rest, named := strings.Cut(s, "=")
+	if !named {
+		rest = s
+	}
+	if i := strings.LastIndex(rest, "."); i >= 0 {
+		h.path, h.fun = rest[:i], rest[i+1:]
+		h.name = path.Base(h.path)
+		if named {
+			h.name = name
+		}
+	} else {
+		h.fun = rest
+	}
+	switch {
+	case named && h.path == "", h.path != "" && strings.ContainsAny(h.path, " \t\"\\"):
+		return nil, fmt.Errorf("invalid %s %q", option, s)
+	case !token.IsIdentifier(h.fun):
+		return nil, fmt.Errorf("invalid %s %q: %q is not a function name", option, s, h.fun)
+	case h.path != "" && !token.IsIdentifier(h.name):
+		return nil, fmt.Errorf("invalid %s %q: name the package of %s as in name=%s", option, s, h.path, rest)
+	}
+	return h, nil
+}
+
+// funcOption returns the function named by the value s of the option named
+// option in the file, or nil if s is empty.
+func (t *transpiler) funcOption(option, s string) (*funcRef, error) {
+	if s == "" {
+		return nil, nil
+	}
+	f, err := parseFuncRef(option, s)
+	if err != nil {
+		return nil, err
+	}
+	if name := importNames(t.file)[f.path]; name != "" && name != "_" && name != "." {
+		// The file imports the package under another name.
+		f.name = name
+	}
+	return f, nil
+}
+
+// expr returns the expression referring to f in the file, and records that
+// the file uses it.
+func (f *funcRef) expr() ast.Expr {
+	f.used = true
+	fun := &ast.Ident{Name: f.fun}
+	if f.path == "" {
+		return fun
+	}
+	return &ast.SelectorExpr{X: &ast.Ident{Name: f.name}, Sel: fun}
+}
+
+// genHook generates the call of the hook with the error errVar propagated
+// by x from fn, the name of fn and the position of x, as in
+//
+//	errtrace.Record(err, "main.loadConfig", "config.ego:42")
+func (t *transpiler) genHook(fn *function, x *ast.TryExpr, errVar string) ast.Stmt {
+	return &ast.ExprStmt{X: &ast.CallExpr{
+		Fun: t.hook.expr(),
+		Args: []ast.Expr{
+			&ast.Ident{Name: errVar},
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(t.file.Name.Name + "." + t.funcName(fn))},
+			&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(t.shortPos(x))},
+		},
+	}}
+}
+
+// addFuncImport imports the package of h if the file calls it.
+func (t *transpiler) addFuncImport(h *funcRef) {
+	if h == nil || !h.used || h.path == "" {
+		return
+	}
+	name := h.name
+	if name == path.Base(h.path) {
+		name = ""
+	}
+	if importNames(t.file)[h.path] == h.name {
+		// Imported under the name of the hook.
+		return
+	}
+	astutil.AddNamedImport(t.fset, t.file, name, h.path)
+}
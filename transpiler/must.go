@@ -0,0 +1,42 @@
+package transpiler
+
+import (
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/astutil"
+)
+
+// lowerMustExprs replaces the must expressions `x!` of the file with try
+// expressions recorded in t.musts. They are hoisted like try expressions,
+// and only their error checks differ: the error is passed to panic rather
+// than propagated, so must expressions work in any function.
+func (t *transpiler) lowerMustExprs() {
+	astutil.Apply(t.file, nil, func(c *astutil.Cursor) bool {
+		x, ok := c.Node().(*ast.MustExpr)
+		if !ok {
+			return true
+		}
+		tryX := &ast.TryExpr{X: x.X, Question: x.Bang}
+		if t.musts == nil {
+			t.musts = make(map[*ast.TryExpr]bool)
+		}
+		t.musts[tryX] = true
+		c.Replace(tryX)
+		return true
+	})
+}
+
+// exprKind describes x in error messages.
+func (t *transpiler) exprKind(x *ast.TryExpr) string {
+	switch {
+	case t.musts[x]:
+		return "must expression"
+	case t.defaults[x] != nil:
+		return "default expression"
+	}
+	return "try expression"
+}
+
+// genPanic generates the statement panicking with errExpr.
+func genPanic(errExpr ast.Expr) ast.Stmt {
+	return &ast.ExprStmt{X: &ast.CallExpr{Fun: &ast.Ident{Name: "panic"}, Args: []ast.Expr{errExpr}}}
+}
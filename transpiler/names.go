@@ -0,0 +1,147 @@
+package transpiler
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// newName returns a name for a new variable in fn based on base. Names of
+// identifiers in fn, of package level declarations and of imports are
+// avoided, as are the names returned before.
+func (t *transpiler) newName(fn *function, base string) string {
+	if fn.names == nil {
+		fn.names = t.usedNames(fn)
+	}
+	name := base
+	for i := 2; fn.names[name]; i++ {
+		name = base + strconv.Itoa(i)
+	}
+	fn.names[name] = true
+	return name
+}
+
+// usedNames collects the names a new variable in fn must not take.
+func (t *transpiler) usedNames(fn *function) map[string]bool {
+	names := map[string]bool{errName(fn.Type): true}
+	for name := range t.file.Scope.Objects {
+		names[name] = true
+	}
+	if t.types != nil {
+		// Declarations of the other files of the package.
+		for _, name := range t.types.pkg.Scope().Names() {
+			names[name] = true
+		}
+	}
+	for _, spec := range t.file.Imports {
+		if spec.Name != nil {
+			names[spec.Name.Name] = true
+			continue
+		}
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		names[path[strings.LastIndex(path, "/")+1:]] = true
+	}
+	for _, n := range []ast.Node{fn.Type, fn.Body} {
+		ast.Inspect(n, func(n ast.Node) bool {
+			if ident, ok := n.(*ast.Ident); ok {
+				names[ident.Name] = true
+			}
+			return true
+		})
+	}
+	return names
+}
+
+// baseName derives the name of a temporary holding the value of x from the
+// function it calls, so that `user := client.GetUser(id)?.Name` declares
+// a temporary named user. It returns "result" if x is not a call to a named
+// function.
+func baseName(x ast.Expr) string {
+	call, ok := ast.Unparen(x).(*ast.CallExpr)
+	if !ok {
+		return "result"
+	}
+	fun := ast.Unparen(call.Fun)
+	switch f := fun.(type) {
+	case *ast.IndexExpr:
+		// Instantiated generic function.
+		fun = f.X
+	case *ast.IndexListExpr:
+		fun = f.X
+	}
+
+	var funName string
+	switch f := fun.(type) {
+	case *ast.Ident:
+		funName = f.Name
+	case *ast.SelectorExpr:
+		funName = f.Sel.Name
+	default:
+		return "result"
+	}
+
+	name := funName
+	for _, prefix := range []string{"Get", "get", "New", "new"} {
+		rest, ok := strings.CutPrefix(funName, prefix)
+		if r, _ := utf8.DecodeRuneInString(rest); ok && unicode.IsUpper(r) {
+			name = rest
+			break
+		}
+	}
+	name = lowerFirst(name)
+
+	// A variable must not shadow the function called, nor take the name of
+	// a keyword or a predeclared identifier.
+	if _, isIdent := fun.(*ast.Ident); isIdent && name == funName || token.IsKeyword(name) || predeclared[name] || name == "_" {
+		name += "Res"
+	}
+	return name
+}
+
+// lowerFirst lowers the first letter of name, or the leading initialism of
+// name, as in "URL" to "url" and "HTTPClient" to "httpClient".
+func lowerFirst(name string) string {
+	runes := []rune(name)
+	n := 0
+	for n < len(runes) && unicode.IsUpper(runes[n]) {
+		n++
+	}
+	if n > 1 && n < len(runes) {
+		// Keep the first letter of the following word.
+		n--
+	}
+	for i := range n {
+		runes[i] = unicode.ToLower(runes[i])
+	}
+	return string(runes)
+}
+
+var predeclared = map[string]bool{}
+
+// pure holds the predeclared functions without side effects and the
+// predeclared types.
+var pure = map[string]bool{}
+
+func init() {
+	for _, name := range strings.Fields(`
+		any bool byte comparable complex64 complex128 error float32 float64
+		int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr
+		true false iota nil
+		append cap clear close complex copy delete imag len make max min new
+		panic print println real recover`) {
+		predeclared[name] = true
+	}
+	for _, name := range strings.Fields(`
+		any bool byte complex64 complex128 error float32 float64
+		int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr
+		cap complex imag len make max min new real`) {
+		pure[name] = true
+	}
+}
@@ -0,0 +1,131 @@
+package transpiler
+
+import (
+	"reflect"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// The printer places comments by comparing their offsets with the positions
+// of the nodes it prints. Generated nodes without positions make it guess,
+// and comments then end up in the middle of the generated code. The helpers
+// below anchor generated nodes next to the source they replace.
+
+// setPos positions the generated nodes in n at pos. A node whose own
+// position is already valid comes from the source, or was positioned
+// before, and its subtree is left untouched. Only tokens that are always
+// printed are set, so optional tokens like an ellipsis stay absent.
+func setPos(n ast.Node, pos token.Pos) {
+	// set positions p if it has no position yet and reports whether it did.
+	set := func(p ...*token.Pos) bool {
+		if p[0].IsValid() {
+			return false
+		}
+		for _, p := range p {
+			*p = pos
+		}
+		return true
+	}
+	ast.Inspect(n, func(n ast.Node) bool {
+		switch x := n.(type) {
+		case *ast.Ident:
+			return set(&x.NamePos)
+		case *ast.BasicLit:
+			return set(&x.ValuePos)
+		case *ast.CompositeLit:
+			return set(&x.Lbrace, &x.Rbrace)
+		case *ast.ParenExpr:
+			return set(&x.Lparen, &x.Rparen)
+		case *ast.IndexExpr:
+			return set(&x.Lbrack, &x.Rbrack)
+		case *ast.IndexListExpr:
+			return set(&x.Lbrack, &x.Rbrack)
+		case *ast.CallExpr:
+			return set(&x.Lparen, &x.Rparen)
+		case *ast.StarExpr:
+			return set(&x.Star)
+		case *ast.UnaryExpr:
+			return set(&x.OpPos)
+		case *ast.BinaryExpr:
+			return set(&x.OpPos)
+		case *ast.KeyValueExpr:
+			return set(&x.Colon)
+		case *ast.ArrayType:
+			return set(&x.Lbrack)
+		case *ast.StructType:
+			return set(&x.Struct)
+		case *ast.FieldList:
+			return set(&x.Opening, &x.Closing)
+		case *ast.InterfaceType:
+			return set(&x.Interface)
+		case *ast.MapType:
+			return set(&x.Map)
+		case *ast.ChanType:
+			return set(&x.Begin)
+		case *ast.GenDecl:
+			return set(&x.TokPos)
+		case *ast.AssignStmt:
+			return set(&x.TokPos)
+		case *ast.ReturnStmt:
+			return set(&x.Return)
+		case *ast.BlockStmt:
+			return set(&x.Lbrace, &x.Rbrace)
+		case *ast.IfStmt:
+			return set(&x.If)
+		}
+		return true
+	})
+}
+
+// lineEnd returns the position of the end of the line containing pos, so
+// that code inserted there is printed after any trailing comment on the line.
+func lineEnd(fset *token.FileSet, pos token.Pos) token.Pos {
+	f := fset.File(pos)
+	if f == nil {
+		return pos
+	}
+	if line := f.Line(pos); line < f.LineCount() {
+		return f.LineStart(line+1) - 1
+	}
+	return token.Pos(f.Base() + f.Size())
+}
+
+// walkPos calls fn with the position fields of n and of the nodes and
+// comments it refers to, once each.
+func walkPos(n ast.Node, fn func(*token.Pos)) {
+	type key struct {
+		typ reflect.Type
+		ptr uintptr
+	}
+	seen := make(map[key]bool)
+	var walk func(v reflect.Value)
+	walk = func(v reflect.Value) {
+		switch v.Kind() {
+		case reflect.Pointer:
+			k := key{v.Type(), v.Pointer()}
+			if v.IsNil() || v.Type() == objectType || v.Type() == scopeType || seen[k] {
+				return
+			}
+			seen[k] = true
+			walk(v.Elem())
+		case reflect.Interface:
+			if !v.IsNil() {
+				walk(v.Elem())
+			}
+		case reflect.Slice:
+			for i := range v.Len() {
+				walk(v.Index(i))
+			}
+		case reflect.Struct:
+			for i := range v.NumField() {
+				if f := v.Field(i); f.Type() != posType {
+					walk(f)
+				} else if f.CanAddr() {
+					fn(f.Addr().Interface().(*token.Pos))
+				}
+			}
+		}
+	}
+	walk(reflect.ValueOf(n))
+}
@@ -0,0 +1,457 @@
+package transpiler
+
+import (
+	"go/types"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// The parser resolves the identifiers of the source to the objects they
+// declare or refer to, but does not keep the scopes of blocks, and knows
+// nothing of the variables declared by generated code. The scopes below
+// are computed from the current state of a function body when a statement
+// is lowered.
+
+// site locates a statement being lowered in the body of a function.
+type site struct {
+	scope  *ast.Scope // declarations visible at the statement
+	fscope *ast.Scope // parameters, results and the outermost block
+	list   []ast.Stmt // statement list containing the statement
+	index  int        // index of the statement in list
+}
+
+// findSite returns the site of target in the body of fn, or nil if target
+// is not found.
+func findSite(fn *function, target ast.Stmt) *site {
+	fscope := ast.NewScope(nil)
+	for _, list := range []*ast.FieldList{fn.Type.Params, fn.Type.Results} {
+		if list == nil {
+			continue
+		}
+		for _, field := range list.List {
+			for _, name := range field.Names {
+				declare(fscope, name)
+			}
+		}
+	}
+	w := &siteWalker{target: target, fscope: fscope}
+	w.stmts(fscope, fn.Body.List)
+	return w.site
+}
+
+type siteWalker struct {
+	target ast.Stmt
+	fscope *ast.Scope
+	site   *site
+}
+
+// stmts walks list in scope and reports whether the target was found.
+func (w *siteWalker) stmts(scope *ast.Scope, list []ast.Stmt) bool {
+	for i, s := range list {
+		if w.stmt(scope, s) {
+			if w.site.list == nil {
+				w.site.list = list
+				w.site.index = i
+			}
+			return true
+		}
+	}
+	return false
+}
+
+// stmt declares the variables declared by s in scope, and looks for the
+// target in the blocks of s.
+func (w *siteWalker) stmt(scope *ast.Scope, s ast.Stmt) bool {
+	if s == w.target {
+		w.site = &site{scope: scope, fscope: w.fscope}
+		return true
+	}
+	switch s := s.(type) {
+	case *ast.AssignStmt:
+		if s.Tok == token.DEFINE {
+			for _, x := range s.Lhs {
+				if ident, ok := x.(*ast.Ident); ok {
+					declare(scope, ident)
+				}
+			}
+		}
+	case *ast.DeclStmt:
+		if decl, ok := s.Decl.(*ast.GenDecl); ok {
+			for _, spec := range decl.Specs {
+				switch spec := spec.(type) {
+				case *ast.ValueSpec:
+					for _, name := range spec.Names {
+						declare(scope, name)
+					}
+				case *ast.TypeSpec:
+					declare(scope, spec.Name)
+				}
+			}
+		}
+	case *ast.LabeledStmt:
+		return w.stmt(scope, s.Stmt)
+	case *ast.BlockStmt:
+		return w.stmts(ast.NewScope(scope), s.List)
+	case *ast.IfStmt:
+		scope = ast.NewScope(scope)
+		if s.Init != nil {
+			w.stmt(scope, s.Init)
+		}
+		if w.stmts(ast.NewScope(scope), s.Body.List) {
+			return true
+		}
+		if s.Else != nil {
+			return w.stmt(scope, s.Else)
+		}
+	case *ast.ForStmt:
+		scope = ast.NewScope(scope)
+		if s.Init != nil {
+			w.stmt(scope, s.Init)
+		}
+		return w.stmts(ast.NewScope(scope), s.Body.List)
+	case *ast.RangeStmt:
+		scope = ast.NewScope(scope)
+		if s.Tok == token.DEFINE {
+			for _, x := range []ast.Expr{s.Key, s.Value} {
+				if ident, ok := x.(*ast.Ident); ok {
+					declare(scope, ident)
+				}
+			}
+		}
+		return w.stmts(ast.NewScope(scope), s.Body.List)
+	case *ast.SwitchStmt:
+		scope = ast.NewScope(scope)
+		if s.Init != nil {
+			w.stmt(scope, s.Init)
+		}
+		return w.clauses(scope, s.Body, nil)
+	case *ast.TypeSwitchStmt:
+		scope = ast.NewScope(scope)
+		if s.Init != nil {
+			w.stmt(scope, s.Init)
+		}
+		var symbol *ast.Ident
+		if assign, ok := s.Assign.(*ast.AssignStmt); ok && len(assign.Lhs) == 1 {
+			symbol, _ = assign.Lhs[0].(*ast.Ident)
+		}
+		return w.clauses(scope, s.Body, symbol)
+	case *ast.SelectStmt:
+		return w.clauses(scope, s.Body, nil)
+	}
+	return false
+}
+
+// clauses walks the case clauses of body, each in a scope of its own
+// declaring symbol if it is not nil.
+func (w *siteWalker) clauses(scope *ast.Scope, body *ast.BlockStmt, symbol *ast.Ident) bool {
+	for _, clause := range body.List {
+		clauseScope := ast.NewScope(scope)
+		if symbol != nil {
+			declare(clauseScope, symbol)
+		}
+		var list []ast.Stmt
+		switch clause := clause.(type) {
+		case *ast.CaseClause:
+			list = clause.Body
+		case *ast.CommClause:
+			if clause.Comm != nil {
+				w.stmt(clauseScope, clause.Comm)
+			}
+			list = clause.Body
+		}
+		if w.stmts(clauseScope, list) {
+			return true
+		}
+	}
+	return false
+}
+
+// declare declares the object of ident in scope, unless scope declares its
+// name already. Generated identifiers have no object, so a new one is made.
+func declare(scope *ast.Scope, ident *ast.Ident) {
+	if ident.Name == "_" {
+		return
+	}
+	obj := ident.Obj
+	if obj == nil {
+		obj = ast.NewObj(ast.Var, ident.Name)
+	}
+	scope.Insert(obj)
+}
+
+// lookup returns the object name refers to in scope and the scope declaring
+// it, or nil if name is not declared.
+func lookup(scope *ast.Scope, name string) (*ast.Object, *ast.Scope) {
+	for ; scope != nil; scope = scope.Outer {
+		if obj := scope.Lookup(name); obj != nil {
+			return obj, scope
+		}
+	}
+	return nil, nil
+}
+
+// errVarAt returns the name of the error variable of the try expressions
+// lowered at site. It is the name errName returns, unless an error variable
+// of that name would overwrite or shadow a variable the source reads, or
+// clash with a later declaration. The error variable of an if statement is
+// scoped to it if scoped is set.
+func (t *transpiler) errVarAt(fn *function, site *site, scoped bool) string {
+	return t.varAt(fn, site, scoped, errName(fn.Type), "error")
+}
+
+// okVarAt is like errVarAt for the ok variable of the try expressions of
+// map indexes, type assertions and receives, see isCommaOk.
+func (t *transpiler) okVarAt(fn *function, site *site, scoped bool) string {
+	return t.varAt(fn, site, scoped, "ok", "bool")
+}
+
+// varAt returns name, or a new name if a variable of that name and of the
+// predeclared type typ cannot be declared or assigned at site, see
+// errVarAt.
+func (t *transpiler) varAt(fn *function, site *site, scoped bool, name, typ string) string {
+	if site == nil {
+		return name
+	}
+
+	obj, _ := lookup(site.scope, name)
+	if obj != nil && obj == errResult(fn.Type) && site.scope == site.fscope && !scoped {
+		// The named error result is assigned on purpose.
+		return name
+	}
+	if obj != nil && obj == errResult(fn.Type) && site.scope != site.fscope && t.deferResults[obj] {
+		// A deferred function sets the error result, which a declaration
+		// in a nested block would shadow.
+		return t.newName(fn, name)
+	}
+	if obj != nil && obj.Decl != nil {
+		if !t.mayHold(obj, typ) {
+			// The variable cannot hold the error.
+			return t.newName(fn, name)
+		}
+		if refersTo(site.list[site.index], name, obj) {
+			return t.newName(fn, name)
+		}
+		if !scoped && readsAfter(site, name, obj) {
+			return t.newName(fn, name)
+		}
+		// A variable declared in the same block is assigned rather than
+		// shadowed, which a closure may observe.
+		if !scoped && site.scope.Lookup(name) == obj && capturedBy(fn.Body, name, obj) {
+			return t.newName(fn, name)
+		}
+	}
+	if !scoped && site.scope.Lookup(name) == nil && redeclaredAfter(site, name) {
+		return t.newName(fn, name)
+	}
+	return name
+}
+
+// mayHold reports whether the variable obj may be of the predeclared type
+// typ. The type of a variable declared without one is that of its value,
+// if known.
+func (t *transpiler) mayHold(obj *ast.Object, typ string) bool {
+	if declared := declaredType(obj); declared != nil {
+		ident, ok := ast.Unparen(declared).(*ast.Ident)
+		return ok && ident.Name == typ && ident.Obj == nil
+	}
+	value, index := initValue(obj)
+	if value == nil {
+		return true
+	}
+	if vt := t.typeOf(value); vt != nil {
+		if tuple, ok := vt.(*types.Tuple); ok && index < tuple.Len() {
+			vt = tuple.At(index).Type()
+		}
+		return types.Identical(vt, types.Universe.Lookup(typ).Type())
+	}
+	if index > 0 {
+		return true
+	}
+	kind, known := valueKind(value)
+	return !known || kind == boolKind && typ == "bool"
+}
+
+// initValue returns the value obj is declared with, and the index of obj
+// among the values of the value if it has several, or nil if obj has no
+// value.
+func initValue(obj *ast.Object) (ast.Expr, int) {
+	var names, values []ast.Expr
+	switch decl := obj.Decl.(type) {
+	case *ast.AssignStmt:
+		names, values = decl.Lhs, decl.Rhs
+	case *ast.ValueSpec:
+		for _, name := range decl.Names {
+			names = append(names, name)
+		}
+		values = decl.Values
+	}
+	for i, x := range names {
+		if ident, ok := x.(*ast.Ident); !ok || ident.Name != obj.Name {
+			continue
+		}
+		switch len(values) {
+		case len(names):
+			return values[i], 0
+		case 1:
+			return values[0], i
+		}
+	}
+	return nil, 0
+}
+
+// valueKind returns the kind of the type of the value x, and whether the
+// type is known not to be an interface. The kind of values of types other
+// than the predeclared ones is unknownKind.
+func valueKind(x ast.Expr) (typeKind, bool) {
+	switch x := ast.Unparen(x).(type) {
+	case *ast.BasicLit:
+		if x.Kind == token.STRING {
+			return stringKind, true
+		}
+		return numberKind, true
+	case *ast.CompositeLit, *ast.FuncLit:
+		return unknownKind, true
+	case *ast.Ident:
+		if (x.Name == "true" || x.Name == "false") && x.Obj == nil {
+			return boolKind, true
+		}
+	case *ast.UnaryExpr:
+		switch x.Op {
+		case token.NOT:
+			return boolKind, true
+		case token.AND, token.ADD, token.SUB, token.XOR:
+			return unknownKind, true
+		}
+	case *ast.BinaryExpr:
+		switch x.Op {
+		case token.EQL, token.NEQ, token.LSS, token.LEQ, token.GTR, token.GEQ, token.LAND, token.LOR:
+			return boolKind, true
+		}
+		return unknownKind, true
+	}
+	return unknownKind, false
+}
+
+// readsAfter reports whether the statements following the site read obj
+// before assigning it.
+func readsAfter(site *site, name string, obj *ast.Object) bool {
+	for _, s := range site.list[site.index+1:] {
+		if assign, ok := s.(*ast.AssignStmt); ok {
+			assigned := false
+			for _, x := range assign.Lhs {
+				if ident, ok := x.(*ast.Ident); ok && ident.Name == name && ident.Obj == obj {
+					assigned = true
+				}
+			}
+			if assigned {
+				for _, x := range assign.Rhs {
+					if refersTo(x, name, obj) {
+						return true
+					}
+				}
+				return false
+			}
+		}
+		if refersTo(s, name, obj) {
+			return true
+		}
+	}
+	return false
+}
+
+// capturedBy reports whether a function literal in body refers to obj.
+func capturedBy(body *ast.BlockStmt, name string, obj *ast.Object) bool {
+	var found bool
+	ast.Inspect(body, func(n ast.Node) bool {
+		if lit, ok := n.(*ast.FuncLit); ok && !found {
+			found = refersTo(lit.Body, name, obj)
+		}
+		return !found
+	})
+	return found
+}
+
+// redeclaredAfter reports whether the statements following the site declare
+// name in the block of the site without declaring anything else, which is
+// an error once the error variable is declared at the site.
+func redeclaredAfter(site *site, name string) bool {
+	declared := make(map[string]bool)
+	for n := range site.scope.Objects {
+		declared[n] = true
+	}
+	for _, s := range site.list[site.index+1:] {
+		switch s := s.(type) {
+		case *ast.AssignStmt:
+			if s.Tok != token.DEFINE {
+				continue
+			}
+			found, others := false, false
+			for _, x := range s.Lhs {
+				ident, ok := x.(*ast.Ident)
+				switch {
+				case !ok || ident.Name == "_":
+				case ident.Name == name:
+					found = true
+				case !declared[ident.Name]:
+					others = true
+					declared[ident.Name] = true
+				}
+			}
+			if found && !others {
+				return true
+			}
+		case *ast.DeclStmt:
+			if decl, ok := s.Decl.(*ast.GenDecl); ok {
+				for _, spec := range decl.Specs {
+					if spec, ok := spec.(*ast.ValueSpec); ok {
+						for _, ident := range spec.Names {
+							if ident.Name == name {
+								return true
+							}
+							declared[ident.Name] = true
+						}
+					}
+				}
+			}
+		}
+	}
+	return false
+}
+
+// declaredType returns the type obj is declared with, or nil if the type
+// is inferred.
+func declaredType(obj *ast.Object) ast.Expr {
+	switch decl := obj.Decl.(type) {
+	case *ast.Field:
+		return decl.Type
+	case *ast.ValueSpec:
+		return decl.Type
+	}
+	return nil
+}
+
+// errResult returns the object of the named error result of ftype if it is
+// of type error, or nil.
+func errResult(ftype *ast.FuncType) *ast.Object {
+	if !hasNamedResults(ftype) {
+		return nil
+	}
+	last := ftype.Results.List[len(ftype.Results.List)-1]
+	if !isError(last.Type) {
+		return nil
+	}
+	return last.Names[len(last.Names)-1].Obj
+}
+
+// refersTo reports whether an identifier in n refers to obj.
+func refersTo(n ast.Node, name string, obj *ast.Object) bool {
+	var found bool
+	ast.Inspect(n, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == name && ident.Obj == obj {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type config struct {
+	port int
+}
+
+type loader struct {
+	dir string
+}
+
+func (l *loader) load(name string) (*config, error) {
+	data, err := os.ReadFile(l.dir + "/" + name)
+	if err != nil {
+		return nil, fmt.Errorf("(*loader).load (main.ego:18): %w", err)
+	}
+	port, err := strconv.Atoi(string(data))
+	if err != nil {
+		return nil, fmt.Errorf("(*loader).load (main.ego:19): parsing port of %s: %w", name, err)
+	}
+	return &config{port: port}, nil
+}
+
+func (l loader) remove(name string) (ok bool, err error) {
+	if err = os.Remove(l.dir + "/" + name); err != nil {
+		return ok, fmt.Errorf("loader.remove (main.ego:24): %w", err)
+	}
+	return true, nil
+}
+
+func ports(args []string) ([]int, error) {
+	var ports []int
+	each := func(f func(string) error) error {
+		for _, arg := range args {
+			if err := f(arg); err != nil {
+				return fmt.Errorf("ports.func1 (main.ego:32): %w", err)
+			}
+		}
+		return nil
+	}
+	if err := each(func(arg string) error {
+		atoi, err := strconv.Atoi(arg)
+		if err != nil {
+			return fmt.Errorf("ports.func2 (main.ego:37): %w", err)
+		}
+		ports = append(ports, atoi)
+		return nil
+	}); err != nil {
+		return nil, fmt.Errorf("ports (main.ego:36): %w", err)
+	}
+	return ports, nil
+}
+
+func sum(args []string) (int, error) {
+	total := 0
+	add := func(arg string) error {
+		parse := func() (int, error) {
+			atoi, err := strconv.Atoi(arg)
+			if err != nil {
+				return 0, fmt.Errorf("sum.func1.1 (main.ego:47): %w", err)
+			}
+			return atoi, nil
+		}
+		parseRes, err := parse()
+		if err != nil {
+			return fmt.Errorf("sum.func1 (main.ego:49): %w", err)
+		}
+		total += parseRes
+		return nil
+	}
+	for _, arg := range args {
+		if err := add(arg); err != nil {
+			return 0, fmt.Errorf("sum (main.ego:53): %w", err)
+		}
+	}
+	return total, nil
+}
+
+func parseAll(args []string, env map[string]string) ([]int, error) {
+	var ns []int
+	for _, arg := range args {
+		atoi, err := strconv.Atoi(arg)
+		if err != nil {
+			err = fmt.Errorf("parseAll (main.ego:64): %w", err)
+			return nil, fmt.Errorf("parsing arguments: %w", err)
+		}
+		ns = append(ns, atoi)
+	}
+	port, ok := env["PORT"]
+	if !ok {
+		err := fmt.Errorf("parseAll (main.ego:66): %w", errors.New("key \"PORT\" not found"))
+		return nil, fmt.Errorf("parsing arguments: %w", err)
+	}
+	atoi2, err := strconv.Atoi(port)
+	if err != nil {
+		err = fmt.Errorf("parseAll (main.ego:67): parsing port: %w", err)
+		return nil, fmt.Errorf("parsing arguments: %w", err)
+	}
+	ns = append(ns, atoi2)
+	return ns, nil
+}
+
+func main() {
+	l := &loader{dir: "/etc"}
+	cfg, err := l.load("app.conf")
+	if err != nil {
+		panic(err)
+	}
+	portsRes, err := ports(os.Args[1:])
+	if err != nil {
+		portsRes = nil
+	}
+	sumRes, err := sum(os.Args[1:])
+	if err != nil {
+		sumRes = 0
+	}
+	parseAllRes, err := parseAll(os.Args[1:], nil)
+	if err != nil {
+		parseAllRes = nil
+	}
+	fmt.Println(cfg.port, portsRes, sumRes, parseAllRes)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+type Config struct {
+	Name  string
+	Ports map[string]int
+}
+
+func load(name string) (*Config, error) {
+	cfg := &Config{Ports: map[string]int{}}
+	// Fields and map entries are assigned.
+	readNameRes, err := readName(name)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Name = readNameRes
+	atoi, err := strconv.Atoi(os.Getenv("PORT"))
+	if err != nil {
+		return nil, err
+	}
+	cfg.Ports["http"] = atoi
+	_, err = os.Stat(name)
+	if err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func readName(name string) (string, error) {
+	var s string
+	if name != "" {
+		s = os.Getenv(name)
+	}
+	_, err := os.Stat(s)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(s)
+	if err != nil {
+		return "", err
+	}
+	s = string(data)
+	s, err = strconv.Unquote(s)
+	if err != nil {
+		return "", err
+	}
+	return s, nil
+}
+
+func count(names []string) (n int, err error) {
+	for _, name := range names {
+		readNameRes, err := readName(name)
+		if err != nil {
+			return n, err
+		}
+		n = len(readNameRes)
+		_, err = os.Stat(name)
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// The operands of the targets are evaluated before the values.
+func store(m map[string]int, p *int, key func() string) error {
+	keyRes := key()
+	atoi, err := strconv.Atoi("1")
+	if err != nil {
+		return err
+	}
+	m[keyRes] = atoi
+	atoi2, err := strconv.Atoi("2")
+	if err != nil {
+		return err
+	}
+	*p = atoi2
+	return nil
+}
+
+func main() {
+	load("config")
+	count(nil)
+	var n int
+	store(map[string]int{}, &n, func() string { return "a" })
+}
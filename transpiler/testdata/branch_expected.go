@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type record struct {
+	name string
+	age  int
+}
+
+func parse(line string) (record, error) {
+	name, age, ok := strings.Cut(line, ",")
+	if !ok {
+		return record{}, fmt.Errorf("malformed line %q", line)
+	}
+	atoi, err := strconv.Atoi(age)
+	if err != nil {
+		return record{}, err
+	}
+	return record{name: name, age: atoi}, nil
+}
+
+func checkTotal(total int) error {
+	if total < 0 {
+		return fmt.Errorf("negative total %d", total)
+	}
+	return nil
+}
+
+// parseAll skips empty and malformed lines.
+func parseAll(lines []string) []record {
+	var records []record
+	for _, line := range lines {
+		if line == "" {
+			continue
+		}
+		rec, err := parse(line)
+		if err != nil {
+			continue
+		}
+		records = append(records, rec)
+	}
+	return records
+}
+
+func sumAges(paths []string) (total int, err error) {
+files:
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("skipping %s: %v", path, err)
+			continue
+		}
+		for _, line := range strings.Split(string(data), "\n") {
+			switch {
+			case strings.HasPrefix(line, "#"):
+				continue
+			case line == "EOF":
+				break files
+			}
+			parseRes, err2 := parse(line)
+			if err2 != nil {
+				break
+			}
+			total += parseRes.age
+			if err3 := checkTotal(total); err3 != nil {
+				continue files
+			}
+		}
+	}
+	return total, nil
+}
+
+// positives skips malformed and non-positive numbers.
+func positives(args []string) []int {
+	var ns []int
+	for _, arg := range args {
+		if n, err := strconv.Atoi(arg); err != nil {
+			continue
+		} else if n > 0 {
+			ns = append(ns, n)
+		}
+	}
+	return ns
+}
+
+func next(i int) (int, error) { return i + 1, nil }
+
+// sumEvery adds the numbers of args, skipping malformed ones.
+func sumEvery(args []string) (sum int, err error) {
+	for i := 0; i < len(args); {
+		atoi, err2 := strconv.Atoi(args[i])
+		if err2 != nil {
+			nextRes, err := next(i)
+			if err != nil {
+				return sum, err
+			}
+			i = nextRes
+			continue
+		}
+		sum += atoi
+		nextRes, err := next(i)
+		if err != nil {
+			return sum, err
+		}
+		i = nextRes
+	}
+	return sum, nil
+}
+
+func main() {
+	fmt.Println(parseAll(os.Args[1:]))
+	fmt.Println(sumAges(os.Args[1:]))
+	fmt.Println(positives(os.Args[1:]))
+	fmt.Println(sumEvery(os.Args[1:]))
+}
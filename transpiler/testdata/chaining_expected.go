@@ -0,0 +1,58 @@
+package main
+
+import "os"
+
+type Client struct{}
+
+type Conn struct{}
+
+type Session struct{}
+
+type Rows struct{}
+
+func (c *Client) Dial() (*Conn, error) { return &Conn{}, nil }
+
+func (c *Conn) Session() (*Session, error) { return &Session{}, nil }
+
+func (s *Session) Query(q string) (*Rows, error) { return &Rows{}, nil }
+
+func (r *Rows) Close() error { return nil }
+
+func NewClient(addr string) (*Client, error) { return &Client{}, nil }
+
+func query(addr, q string) (*Rows, error) {
+	client, err := NewClient(addr)
+	if err != nil {
+		return nil, err
+	}
+	dial, err := client.Dial()
+	if err != nil {
+		return nil, err
+	}
+	session, err := dial.Session()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := session.Query(q)
+	if err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+func stat(name string) (string, error) {
+	session := "session"
+	open, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	if err := open.Close(); err != nil {
+		return "", err
+	}
+	stat2, err := os.Stat(name)
+	if err != nil {
+		return "", err
+	}
+	name = stat2.Name() + session
+	return name, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+)
+
+type config map[string]string
+
+func lookup(c config, key string) (string, error) {
+	v, ok := c[key]
+	if !ok {
+		return "", fmt.Errorf("key %q not found", key)
+	}
+	return v, nil
+}
+
+func port(c config) (int, error) {
+	// A literal key is spelled out in the message.
+	p, ok := c["port"]
+	if !ok {
+		return 0, fmt.Errorf("reading port: %w", errors.New("key \"port\" not found"))
+	}
+	return strconv.Atoi(p)
+}
+
+func name(v any) (string, error) {
+	s, ok := v.(fmt.Stringer)
+	if !ok {
+		return "", fmt.Errorf("unexpected type %T, want fmt.Stringer", v)
+	}
+	return s.String(), nil
+}
+
+func reader(v any) (io.Reader, error) {
+	r, ok := v.(io.Reader)
+	if !ok {
+		err := fmt.Errorf("unexpected type %T, want io.Reader", v)
+		return nil, fmt.Errorf("not a reader: %w", err)
+	}
+	return r, nil
+}
+
+func first(ch chan string) (msg string, err error) {
+	msg, ok := <-ch
+	if !ok {
+		return msg, errors.New("receive from closed channel")
+	}
+	return
+}
+
+func sum(m map[string]int, a, b string) (int, error) {
+	ok := "unused"
+	result, ok2 := m[a]
+	if !ok2 {
+		return 0, fmt.Errorf("key %q not found", a)
+	}
+	result2, ok2 := m[b]
+	if !ok2 {
+		return 0, fmt.Errorf("key %q not found", b)
+	}
+	n := result + result2
+	fmt.Println(ok)
+	return n, nil
+}
+
+func count(counts map[string]int, key string) int {
+	n, ok := counts[key]
+	if !ok {
+		n = 0
+	}
+	return n
+}
+
+func total(counts map[string]int, keys []string) (n int, err error) {
+	for _, key := range keys {
+		v, ok := counts[key]
+		if !ok {
+			continue
+		}
+		n += v
+	}
+	return
+}
+
+func require(c config, keys []string) error {
+	for _, key := range keys {
+		if _, ok := c[key]; !ok {
+			return fmt.Errorf("key %v not found", key)
+		}
+	}
+	return nil
+}
+
+func main() {
+	c := config{"port": "8080"}
+	fmt.Println(lookup(c, "host"))
+	fmt.Println(port(c))
+	fmt.Println(name(os.Args))
+	fmt.Println(reader(os.Args))
+	ch := make(chan string, 1)
+	close(ch)
+	fmt.Println(first(ch))
+	fmt.Println(sum(map[string]int{"a": 1}, "a", "b"))
+	fmt.Println(count(map[string]int{}, "a"))
+	fmt.Println(total(map[string]int{"a": 1}, []string{"a", "b"}))
+	fmt.Println(require(c, []string{"port", "host"}))
+	result, ok := c["port"]
+	if !ok {
+		panic(errors.New("key \"port\" not found"))
+	}
+	fmt.Println(result)
+}
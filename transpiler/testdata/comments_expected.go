@@ -0,0 +1,42 @@
+//go:build linux
+
+// Package main does things.
+package main
+
+//go:generate echo hi
+
+/*
+#include <stdio.h>
+*/
+import "C"
+
+import "os"
+
+// load loads the file.
+func load(p string) (string, error) {
+	// open it
+	f, err := os.Open(p) // trailing open
+	if err != nil {
+		return "", err
+	}
+	// after open
+	defer f.Close()
+
+	// sync it
+	if err := f.Sync(); err != nil { // trailing sync
+		return "", err
+	}
+
+	if fd, err := f.Fd(); err != nil {
+		return "", err
+	} else if fd > 0 { // trailing if
+		// inside if
+		return "", nil
+	} else if fd2, err := f.Fd(); err != nil {
+		return "", err
+	} else if fd2 { // else-if
+		return "x", nil // ret
+	}
+	// final
+	return "", nil // end
+}
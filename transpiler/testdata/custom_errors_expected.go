@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+type MyError struct {
+	Op string
+}
+
+func (e *MyError) Error() string { return e.Op }
+
+// Coded is an error with a code.
+type Coded interface {
+	error
+	Code() int
+}
+
+func validate(s string) *MyError {
+	if s == "" {
+		return &MyError{Op: "validate"}
+	}
+	return nil
+}
+
+// Errors of other types are passed to panic.
+func parse(s string) (int, *MyError) {
+	if myError := validate(s); myError != nil {
+		return 0, myError
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		if myError2, ok := err.(*MyError); ok {
+			return 0, myError2
+		}
+		panic(err)
+	}
+	return n, nil
+}
+
+func open(name string) (*os.File, Coded) {
+	open2, err := os.Open(name)
+	if err != nil {
+		if coded, ok := err.(Coded); ok {
+			return nil, coded
+		}
+		panic(err)
+	}
+	return open2, nil
+}
+
+func first[E error](names []string) (string, E) {
+	for _, name := range names {
+		_, err := os.Stat(name)
+		if err != nil {
+			if e, ok := err.(E); ok {
+				return "", e
+			}
+			panic(err)
+		}
+	}
+	return names[0], *new(E)
+}
+
+func count(s string) (n int, err *MyError) {
+	n, myError := parse(s)
+	if myError != nil {
+		return n, myError
+	}
+	return n, nil
+}
+
+// The error of parse has a variable of its own, which the error of os.Open
+// does not reuse.
+func load(s string) (*os.File, error) {
+	n, myError := parse(s)
+	if myError != nil {
+		return nil, myError
+	}
+	f, err := os.Open(s + strconv.Itoa(n))
+	if err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func main() {
+	parse("1")
+	open("x")
+	first[error](nil)
+	count("2")
+	load("3")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type config struct {
+	port    int
+	workers int
+}
+
+func load() (c config, err error) {
+	atoi, err2 := strconv.Atoi(os.Getenv("PORT"))
+	if err2 != nil {
+		atoi = 8080
+	}
+	c.port = atoi
+	workers, err3 := strconv.Atoi(os.Getenv("WORKERS"))
+	if err3 != nil {
+		workers = 4
+	}
+	c.workers = workers
+	if dir := os.Getenv("CONFIG_DIR"); dir != "" {
+		atoi2, err4 := strconv.Atoi(os.Getenv("WORKERS_" + dir))
+		if err4 != nil {
+			atoi2, err = strconv.Atoi(os.Getenv("WORKERS"))
+			if err != nil {
+				return c, err
+			}
+		}
+		c.workers = atoi2
+	}
+	return
+}
+
+func timeout(s string) (int, error) {
+	// The fallback is only parsed when s is malformed.
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		n, err = strconv.Atoi(os.Getenv("TIMEOUT"))
+		if err != nil {
+			return 0, err
+		}
+	}
+	return n, nil
+}
+
+func retries() int {
+	atoi, err := strconv.Atoi(os.Getenv("RETRIES"))
+	if err != nil {
+		atoi, err = strconv.Atoi(os.Getenv("DEFAULT_RETRIES"))
+		if err != nil {
+			atoi = 3
+		}
+	}
+	return atoi
+}
+
+func main() {
+	atoi, err := strconv.Atoi(os.Getenv("RETRIES"))
+	if err != nil {
+		atoi = 3
+	}
+	fmt.Println(atoi + 1)
+	verbose := false
+	verbose, err = strconv.ParseBool(os.Getenv("VERBOSE"))
+	if err != nil {
+		verbose = false
+	}
+	parseBool, err := strconv.ParseBool(os.Getenv("DEBUG"))
+	if err != nil {
+		parseBool = verbose
+	}
+	if parseBool {
+		fmt.Println("debug")
+	}
+	{
+		level, err := strconv.Atoi(os.Getenv("LEVEL"))
+		if err != nil {
+			level = 1
+		}
+		if level > 0 {
+			fmt.Println("level", level)
+		}
+	}
+	c, err := load()
+	if err != nil {
+		panic(err)
+	}
+	timeoutRes, err := timeout("10")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(c, timeoutRes, retries())
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+)
+
+type Config struct {
+	Name string
+}
+
+// readConfig gets an error result named err for the deferred Close.
+func readConfig(path string) (_ *Config, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}()
+
+	var c Config
+	if err = json.NewDecoder(f).Decode(&c); err != nil {
+		return
+	}
+	return &c, nil
+}
+
+// writeConfig names its error result already.
+func writeConfig(path string, c *Config) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			err = errors.Join(err, closeErr)
+		}
+	}() // flushes the file
+	if err = json.NewEncoder(f).Encode(c); err != nil {
+		return
+	}
+	return nil
+}
+
+// copyConfig mentions err, so its error result gets another name.
+func copyConfig(src, dst string) (_ int, err2 error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if closeErr := in.Close(); closeErr != nil {
+			err2 = errors.Join(err2, closeErr)
+		}
+	}()
+	out, err2 := os.Create(dst)
+	if err2 != nil {
+		return
+	}
+	defer func() {
+		if closeErr2 := out.Close(); closeErr2 != nil {
+			err2 = errors.Join(err2, closeErr2)
+		}
+	}()
+	n, err2 := out.ReadFrom(in)
+	if err2 != nil {
+		return
+	}
+	return int(n), nil
+}
+
+// readConfigs closes the files it opens in a loop once it returns.
+func readConfigs(paths []string) (_ []Config, err error) {
+	var cs []Config
+	for _, path := range paths {
+		f, err2 := os.Open(path)
+		if err2 != nil {
+			return nil, err2
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil {
+				err = errors.Join(err, closeErr)
+			}
+		}()
+		var c Config
+		if err3 := json.NewDecoder(f).Decode(&c); err3 != nil {
+			return nil, err3
+		}
+		cs = append(cs, c)
+	}
+	return cs, nil
+}
+
+// readOptional opens the file only if there is one.
+func readOptional(path string) (_ *Config, err error) {
+	var c Config
+	if path != "" {
+		f, err2 := os.Open(path)
+		if err2 != nil {
+			return nil, err2
+		}
+		defer func() {
+			if closeErr := f.Close(); closeErr != nil {
+				err = errors.Join(err, closeErr)
+			}
+		}()
+		if err3 := json.NewDecoder(f).Decode(&c); err3 != nil {
+			return nil, err3
+		}
+	}
+	return &c, nil
+}
+
+func main() {
+	save := func(c *Config) (err error) {
+		defer func() {
+			if removeErr := os.Remove("config.tmp"); removeErr != nil {
+				err = errors.Join(err, removeErr)
+			}
+		}()
+		return writeConfig("config.tmp", c)
+	}
+	if err := save(&Config{Name: "ego"}); err != nil {
+		println(err.Error())
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	n, err := strconv.Atoi("42")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 42 {
+		t.Errorf("got %d", n)
+	}
+	check := func(s string) {
+		// The test parameter is in scope.
+		_, err := strconv.Atoi(s)
+		if err != nil {
+			t.Fatal(fmt.Errorf("check %s: %w", s, err))
+		}
+	}
+	check("1")
+	done := make(chan bool)
+	go func() {
+		// A goroutine cannot end the test.
+		_, err := strconv.Atoi("x")
+		if err != nil {
+			panic(err)
+		}
+		done <- true
+	}()
+	<-done
+}
+
+func mustAtoi(s string) int {
+	atoi, err := strconv.Atoi(s)
+	if err != nil {
+		panic(err)
+	}
+	return atoi
+}
+
+func init() {
+	if err := os.Setenv("MODE", "test"); err != nil {
+		panic(err)
+	}
+}
+
+func main() {
+	data, err := os.ReadFile("config")
+	if err != nil {
+		log.Fatal(err)
+	}
+	println(mustAtoi(string(data)))
+	if n, err := strconv.Atoi(os.Getenv("N")); err != nil {
+		log.Fatal(err)
+	} else if n > 0 {
+		println(n)
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// readPort reads the port from the file.
+func readPort(name string) (int, error) {
+	data, err := os.ReadFile(name) // read it all
+	if err != nil {
+		// Name the file in the error.
+		return 0, fmt.Errorf("reading %s: %w", name, err) // wrapped
+	}
+	port, err := strconv.Atoi(string(data))
+	if err != nil {
+		// Name the file in the error.
+		err = fmt.Errorf("parsing: %w", err)
+		return 0, fmt.Errorf("reading %s: %w", name, err) // wrapped
+	}
+	// check the range
+	if port > 65535 {
+		return 0, fmt.Errorf("port %d out of range", port)
+	}
+	return port, nil
+}
+
+// touch creates the file and reports its size.
+func touch(name string) error {
+	f, err := os.Create(name)
+	if err != nil {
+		// The file may exist already.
+		return err
+	}
+	if err := f.Close(); err != nil { // closed
+		// The file may exist already.
+		return err
+	}
+	stat, err := f.Stat()
+	if err != nil { // The file may exist already.
+		return err
+	}
+	fmt.Println(stat.Size()) // size
+	return nil
+}
+
+func main() {
+	port, err := readPort("port")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(port)
+	if err := touch("file"); err != nil {
+		panic(err)
+	}
+}
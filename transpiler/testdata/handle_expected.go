@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+)
+
+type config struct {
+	name  string
+	port  int
+	debug bool
+}
+
+func loadConfig(name string) (*config, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("loading %s: %w", name, err)
+	}
+	lines := strings.Split(string(data), "\n")
+	cfg := &config{name: lines[0]}
+	if len(lines) > 1 {
+		atoi, err := strconv.Atoi(lines[1])
+		if err != nil {
+			return nil, fmt.Errorf("loading %s: %w", name, err)
+		}
+		cfg.port = atoi
+	}
+	for _, line := range lines[2:] {
+		// The debug flag is optional.
+		parseBool, err := strconv.ParseBool(line)
+		if err != nil {
+			continue
+		}
+		cfg.debug = parseBool
+	}
+	return cfg, nil
+}
+
+func parsePorts(args []string) (ports []int, err error) {
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			port, err := strconv.Atoi(arg[1:])
+			if err != nil {
+				err = fmt.Errorf("negated: %w", err)
+				log.Printf("skipping %q: %v", arg, err)
+				continue
+			}
+			ports = append(ports, -port)
+			continue
+		}
+		atoi, err := strconv.Atoi(arg)
+		if err != nil {
+			return nil, fmt.Errorf("parsing ports: %w", err)
+		}
+		ports = append(ports, atoi)
+	}
+	return ports, nil
+}
+
+func main() {
+	cfg, err := loadConfig("app.conf")
+	if err != nil {
+		log.Fatal(err)
+	}
+	ports, err := parsePorts(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	check := func(port int) error {
+		if port == cfg.port {
+			return nil
+		}
+		if err := os.Setenv("PORT", strconv.Itoa(port)); err != nil {
+			return err
+		}
+		return nil
+	}
+	for _, port := range ports {
+		if err := check(port); err != nil {
+			log.Fatal(err)
+		}
+	}
+	fmt.Println(cfg.name, ports)
+}
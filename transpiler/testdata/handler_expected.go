@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+var ErrFallback = errors.New("fallback")
+
+func readConfig(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		log.Print(err)
+		return nil, ErrFallback
+	}
+	return data, nil
+}
+
+func parsePorts(args []string) []int {
+	var ports []int
+	for _, arg := range args {
+		port, err := strconv.Atoi(arg)
+		if err != nil {
+			log.Printf("skipping %q: %v", arg, err)
+			continue
+		}
+		ports = append(ports, port)
+	}
+	return ports
+}
+
+func mustRemove(path string) {
+	if e := os.Remove(path); e != nil {
+		panic(fmt.Sprintf("remove %s: %v", path, e))
+	}
+}
+
+func total(a, b string) (int, error) {
+	atoi, err := strconv.Atoi(a)
+	if err != nil {
+		return 0, err
+	}
+	atoi2, err := strconv.Atoi(b)
+	if err != nil {
+		return 0, fmt.Errorf("second operand: %w", err)
+	}
+	return atoi + atoi2, nil
+}
+
+func limit(s string) (int, error) {
+	if n, err := strconv.Atoi(s); err != nil {
+		return 0, fmt.Errorf("limit: %w", err)
+	} else if n > 0 {
+		return n, nil
+	}
+	return 100, nil
+}
+
+func main() {
+	data, err := readConfig("app.conf")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(len(data), parsePorts(os.Args[1:]))
+	fmt.Println(limit("10"))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+)
+
+func setup() error { return nil }
+
+// The error of setup is reported after the file is read.
+func report(name string) ([]byte, error) {
+	err := setup()
+	data, err2 := os.ReadFile(name)
+	if err2 != nil {
+		return nil, err2
+	}
+	if err != nil {
+		log.Print(err)
+	}
+	return data, nil
+}
+
+// The error of setup is read in the if statement.
+func check(s string) (bool, error) {
+	err := setup()
+	if atoi, err2 := strconv.Atoi(s); err2 != nil {
+		return false, err2
+	} else if atoi > 0 {
+		return err == nil, nil
+	}
+	return false, nil
+}
+
+// The error is observed by a deferred function.
+func cleanup(name string) error {
+	var err error
+	defer func() {
+		if err != nil {
+			log.Print(err)
+		}
+	}()
+	f, err2 := os.Open(name)
+	if err2 != nil {
+		return err2
+	}
+	defer f.Close()
+	err = errors.New("not implemented")
+	return err
+}
+
+// err is declared after the first check.
+func later(name string) error {
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	info, err2 := os.Stat(name + ".bak")
+	if err2 != nil {
+		return err2
+	}
+	err := os.Remove(info.Name())
+	return err
+}
+
+// The conventional names are used when nothing collides.
+func plain(name string) error {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(string(data))
+	if err != nil {
+		return err
+	}
+	_, err = os.Stat(name + strconv.Itoa(n))
+	return err
+}
+
+// err and ok hold values of other types.
+func other(s string, m map[string]int) (int, error) {
+	err := "not an error"
+	ok := 3
+	log.Print(err, ok)
+	n, err2 := strconv.Atoi(s)
+	if err2 != nil {
+		return 0, err2
+	}
+	v, ok2 := m[s]
+	if !ok2 {
+		return 0, fmt.Errorf("key %q not found", s)
+	}
+	return n + v, nil
+}
+
+func main() {
+	report("a")
+	check("1")
+	cleanup("b")
+	later("c")
+	plain("d")
+	other("1", map[string]int{"1": 2})
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"strconv"
+)
+
+func lookup(key string) (int, error) { return 0, nil }
+
+func valid(n int) (bool, error) { return true, nil }
+
+func check(key string) (string, error) {
+	// Check the value of the key.
+	if v, err := lookup(key); err != nil {
+		return "", err
+	} else if v > 0 {
+		return "positive", nil
+	} else if v < 0 {
+		return "negative", nil
+	}
+
+	{
+		n := len(key)
+		cond := n > 0
+		if cond {
+			validRes, err := valid(n)
+			if err != nil {
+				return "", err
+			}
+			cond = validRes
+		}
+		if cond {
+			return "valid", nil
+		} else if v, err := lookup(key + "_default"); err != nil {
+			return "", err
+		} else if v == 0 {
+			return "zero", nil
+		} else if err := os.Chdir(key); err != nil {
+			return "", err
+		} else if key == "." {
+			return "current", nil
+		} else {
+			return "other", nil
+		}
+	}
+}
+
+func parse(s string) (n int, err error) {
+	if n, err = strconv.Atoi(s); err != nil {
+		return n, err
+	} else {
+		cond := n > 0
+		if cond {
+			validRes, err := valid(n)
+			if err != nil {
+				return n, err
+			}
+			cond = validRes
+		}
+		if cond {
+			return n, nil
+		}
+	}
+	if v, err := strconv.Atoi(s + "0"); err != nil {
+		return n, err
+	} else if validRes2, err := valid(v); err != nil {
+		return n, err
+	} else if validRes2 {
+		n = v
+	}
+	return
+}
+
+func main() {
+	check("key")
+	parse("1")
+}
@@ -5,18 +5,19 @@ func someFunc() (int, error) {
 }
 
 func callSomeFunc() (bool, error) {
-	if result, err := someFunc(); err != nil {
+	if someFuncRes, err := someFunc(); err != nil {
 		return false, err
-	} else if result > 0 {
+	} else if someFuncRes > 0 {
 		return true, nil
-	} else if result, err := someFunc(); err != nil {
+	} else if someFuncRes2, err := someFunc(); err != nil {
 		return false, err
-	} else if result {
+	} else if someFuncRes2 {
 		return true, nil
 	}
-	if result, err := someFunc(); err != nil {
+
+	if someFuncRes3, err := someFunc(); err != nil {
 		return false, err
-	} else if result {
+	} else if someFuncRes3 {
 		return true, nil
 	}
 
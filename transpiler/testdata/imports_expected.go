@@ -0,0 +1,58 @@
+package main
+
+import (
+	errors2 "errors"
+	fmt2 "fmt"
+	"os"
+
+	"github.com/pkg/errors"
+)
+
+// The file imports another errors package, so the standard one is
+// imported under another name.
+func sync(name string) (err error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil {
+			err = errors2.Join(err, closeErr)
+		}
+	}()
+	return errors.Wrap(f.Sync(), "sync")
+}
+
+func count(v any) (int, error) {
+	n, ok := v.(int)
+	if !ok {
+		return 0, fmt2.Errorf("unexpected type %T, want int", v)
+	}
+	return n, nil
+}
+
+func recv(ch chan string) (string, error) {
+	s, ok := <-ch
+	if !ok {
+		return "", errors2.New("receive from closed channel")
+	}
+	return s, nil
+}
+
+// The fmt parameter shadows the package.
+func open(fmt string) (*os.File, error) {
+	f, err := os.Open(fmt)
+	if err != nil {
+		return nil, fmt2.Errorf("open %s: %w", fmt, err)
+	}
+	return f, nil
+}
+
+func main() {
+	sync("a")
+	count(1)
+	ch := make(chan string)
+	close(ch)
+	recv(ch)
+	open("b")
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	fmt2 "fmt"
+	"os"
+	"strconv"
+)
+
+// The fmt parameter shadows the package in open only.
+func open(fmt string) (*os.File, error) {
+	f, err := os.Open(fmt)
+	if err != nil {
+		return nil, fmt2.Errorf("open %s: %w", fmt, err)
+	}
+	return f, nil
+}
+
+func parse(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("parse %s: %w", s, err)
+	}
+	return n, nil
+}
+
+// The fmt variable of parseAll shadows the package in the literal.
+func parseAll(args []string) error {
+	fmt := "parsing %d arguments"
+	each := func() error {
+		for _, arg := range args {
+			if err := os.Chdir(arg); err != nil {
+				return fmt2.Errorf("chdir %s: %w", arg, err)
+			}
+		}
+		return nil
+	}
+	println(fmt, len(args))
+	return each()
+}
+
+// A variable declared after the check does not shadow the package.
+func check(s string) error {
+	if err := os.Chdir(s); err != nil {
+		return fmt.Errorf("chdir %s: %w", s, err)
+	}
+	fmt := s
+	println(fmt)
+	return nil
+}
+
+func main() {
+	fmt.Println(parse("1"))
+	open("a")
+	parseAll(nil)
+	check("2")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bufio"
+	"os"
+)
+
+func sum(path string) (int, error) {
+	total := 0
+	// Range over the items.
+	items, err := getItems()
+	if err != nil {
+		return 0, err
+	}
+	for _, item := range items {
+		total += len(item)
+	}
+	countRes, err := count()
+	if err != nil {
+		return 0, err
+	}
+	for i, n := 0, countRes; i < n; i++ {
+		total += i
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for {
+		cond := scanner.Scan()
+		if cond {
+			moreRes, err := more()
+			if err != nil {
+				return 0, err
+			}
+			cond = moreRes
+		}
+		if !cond {
+			break
+		}
+		total++
+	}
+
+	if total > 0 {
+	outer:
+		for i := 0; ; {
+			limitRes, err := limit()
+			if err != nil {
+				return 0, err
+			}
+			if !(i < limitRes) {
+				break
+			}
+			for j := range i {
+				if j > 3 {
+					continue
+				}
+				break outer
+			}
+			if i%2 == 1 {
+				// Skip odd numbers.
+				nextRes, err := next(i)
+				if err != nil {
+					return 0, err
+				}
+				i = nextRes
+				continue
+			}
+			total += i
+			nextRes, err := next(i)
+			if err != nil {
+				return 0, err
+			}
+			i = nextRes
+		}
+	}
+	return total, nil
+}
+
+func getItems() ([]string, error) { return nil, nil }
+
+func count() (int, error) { return 3, nil }
+
+func more() (bool, error) { return false, nil }
+
+func limit() (int, error) { return 3, nil }
+
+func next(i int) (int, error) { return i + 1, nil }
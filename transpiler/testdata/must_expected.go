@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type config struct {
+	name  string
+	debug bool
+}
+
+func loadConfig(path string) (*config, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return &config{name: string(data)}, nil
+}
+
+// port panics on a malformed port, which is a programming error.
+func port(s string) int {
+	atoi, err := strconv.Atoi(s)
+	if err != nil {
+		panic(err)
+	}
+	return atoi
+}
+
+func double(s string) (int, error) {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, err
+	}
+	m, err := strconv.Atoi("2")
+	if err != nil {
+		panic(err)
+	}
+	return n * m, nil
+}
+
+func main() {
+	cfg, err := loadConfig("app.conf")
+	if err != nil {
+		panic(err)
+	}
+	if !cfg.debug && cfg.name != "" {
+		fmt.Println(cfg.name)
+	}
+	if err := os.Setenv("PORT", "8080"); err != nil {
+		panic(err)
+	}
+	portRes := port(os.Getenv("PORT"))
+	atoi, err := strconv.Atoi("1")
+	if err != nil {
+		panic(err)
+	}
+	fmt.Println(portRes + atoi)
+	if parseBool, err := strconv.ParseBool("true"); err != nil {
+		panic(err)
+	} else if parseBool {
+		fmt.Println("enabled!")
+	}
+	if n, err := strconv.Atoi("3"); err != nil {
+		panic(err)
+	} else if n > 2 {
+		fmt.Println(n)
+	}
+	atoi2, err := strconv.Atoi("4")
+	if err != nil {
+		panic(err)
+	}
+	switch n := atoi2; n {
+	case 4:
+		fmt.Println("four")
+	}
+	run := func() {
+		doubleRes, err := double("21")
+		if err != nil {
+			panic(err)
+		}
+		fmt.Println(doubleRes)
+	}
+	run()
+}
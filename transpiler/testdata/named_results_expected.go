@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+func copyFile(dst, src string) (n int64, err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return
+	}
+	defer in.Close()
+	out, err := os.Create(dst)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	_, err = out.Seek(0, io.SeekStart)
+	if err != nil {
+		return
+	}
+	if n > 0 {
+		size, err := io.Copy(out, in)
+		if err != nil {
+			return n, err
+		}
+		n += size
+	}
+	n, err = io.Copy(out, in)
+	if err != nil {
+		return n, fmt.Errorf("copy %s: %w", src, err)
+	}
+	if err = out.Sync(); err != nil {
+		return
+	}
+	return n, nil
+}
+
+func count(path string) (lines, words int, e error) {
+	f, e := os.Open(path)
+	if e != nil {
+		return
+	}
+	defer f.Close()
+	if stat, e := f.Stat(); e != nil {
+		return lines, words, e
+	} else if stat != nil {
+		lines++
+	}
+	return lines, words, nil
+}
+
+func skip() (_ int, err error) {
+	if err = os.Remove("tmp"); err != nil {
+		return
+	}
+	return 0, nil
+}
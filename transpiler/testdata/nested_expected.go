@@ -0,0 +1,94 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+type Config struct {
+	Name string
+	Port int
+}
+
+func load() (string, error) { return "config", nil }
+
+func count() (int, error) { return 1, nil }
+
+func read() (string, error) { return "42", nil }
+
+func key() (string, error) { return "key", nil }
+
+func split() (string, int, error) { return "localhost", 8080, nil }
+
+func run(m map[string]int, ch chan<- int) (*Config, error) {
+	loadRes, err := load()
+	if err != nil {
+		return nil, err
+	}
+	fmt.Println(loadRes)
+	total := 0
+	countRes, err := count()
+	if err != nil {
+		return nil, err
+	}
+	total += countRes
+	loadRes2, err := load()
+	if err != nil {
+		return nil, err
+	}
+	readRes, err := read()
+	if err != nil {
+		return nil, err
+	}
+	atoi, err := strconv.Atoi(readRes)
+	if err != nil {
+		return nil, err
+	}
+	cfg := Config{Name: loadRes2, Port: atoi}
+	readRes2, err := read()
+	if err != nil {
+		return nil, err
+	}
+	x, err := strconv.Atoi(readRes2)
+	if err != nil {
+		return nil, err
+	}
+	keyRes, err := key()
+	if err != nil {
+		return nil, err
+	}
+	m[keyRes] = x
+	keyRes2, err := key()
+	if err != nil {
+		return nil, err
+	}
+	m[keyRes2]++
+	if total > 0 {
+		countRes2, err := count()
+		if err != nil {
+			return nil, err
+		}
+		ch <- countRes2 * 2
+	}
+	loadRes3, err := load()
+	if err != nil {
+		return nil, err
+	}
+	defer fmt.Println("loaded", loadRes3)
+	loadRes4, err := load()
+	if err != nil {
+		return nil, err
+	}
+	countRes3, err := count()
+	if err != nil {
+		return nil, err
+	}
+	var name, port = loadRes4, -countRes3
+	splitRes, splitRes2, err := split()
+	if err != nil {
+		return nil, err
+	}
+	var host, hostPort = splitRes, splitRes2
+	fmt.Println(name, port, total, host, hostPort)
+	return &cfg, nil
+}
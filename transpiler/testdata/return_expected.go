@@ -0,0 +1,66 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+)
+
+type Config struct {
+	Port int
+}
+
+func parse(data []byte) (*Config, error) {
+	port, err := strconv.Atoi(string(data))
+	if err != nil {
+		return nil, err
+	}
+	return &Config{Port: port}, nil
+}
+
+// load reads and parses the configuration file.
+func load(name string) (*Config, error) {
+	readFile, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return parse(readFile)
+}
+
+func contents(name string) ([]byte, error) {
+	readFile, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return readFile, nil // the whole file
+}
+
+func size(name string) (int, error) {
+	readFile, err := os.ReadFile(name)
+	if err != nil {
+		return 0, fmt.Errorf("read %s: %w", name, err)
+	}
+	return len(readFile), nil
+}
+
+func remove(name string) error {
+	if err := os.Remove(name); err != nil {
+		return err
+	}
+	return nil
+}
+
+func lookup(name string) (value string, found bool, err error) {
+	if name == "" {
+		return os.Getenv("HOME"), true, nil
+	}
+	unquote, err := strconv.Unquote(name)
+	if err != nil {
+		return
+	}
+	return unquote, true, nil
+}
+
+func main() {
+	load("config.txt")
+}
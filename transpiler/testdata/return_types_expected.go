@@ -10,7 +10,7 @@ type intAlias int
 func example() (int, bool, string, intAlias, *bytes.Buffer, bytes.Buffer, byte, uintptr, float32, error) {
 	_, err := os.Open("hello.ego")
 	if err != nil {
-		return 0, false, "", *new(intAlias), nil, *new(bytes.Buffer), 0, 0, 0, err
+		return 0, false, "", 0, nil, *new(bytes.Buffer), 0, 0, 0, err
 	}
 	return 0, false, "", *new(intAlias), nil, *new(bytes.Buffer), 0, 0, 0, err
 }
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+)
+
+type Value struct {
+	Kind string
+}
+
+func describe(name string) (string, error) {
+	// Switch on the kind of the file.
+	kindRes, err := kind(name)
+	if err != nil {
+		return "", err
+	}
+	switch kindRes {
+	case "json":
+		return "JSON", nil
+	case "yaml":
+		return "YAML", nil
+	}
+
+	readFile, err := os.ReadFile(name)
+	if err != nil {
+		return "", err
+	}
+	decodeRes, err := decode(readFile)
+	if err != nil {
+		return "", err
+	}
+	switch v := decodeRes; v.Kind {
+	case "object":
+		return "an object", nil
+	}
+
+	{
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", err
+		}
+		kindRes2, err := kind(string(data))
+		if err != nil {
+			return "", err
+		}
+	check:
+		switch kindRes2 {
+		case "json":
+			if len(data) == 0 {
+				break check
+			}
+			return "JSON data", nil
+		}
+	}
+
+loop:
+	for {
+		loadRes, err := load(name)
+		if err != nil {
+			return "", err
+		}
+		switch x := loadRes.(type) {
+		case string:
+			return x, nil
+		case nil:
+			break loop
+		}
+	}
+	return "unknown", nil
+}
+
+func kind(name string) (string, error) { return "json", nil }
+
+func decode(data []byte) (Value, error) {
+	var v Value
+	err := json.Unmarshal(data, &v)
+	return v, err
+}
+
+func load(name string) (any, error) { return nil, nil }
+
+func main() {
+	describe("config.json")
+}
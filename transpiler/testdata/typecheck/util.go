@@ -0,0 +1,27 @@
+package main
+
+import "strings"
+
+// codedError is an error with a code, declared outside of the .ego file.
+type codedError struct {
+	code int
+}
+
+func (e *codedError) Error() string {
+	return "code " + strings.Repeat("!", e.code)
+}
+
+func split(s string) (string, string, error) {
+	before, after, found := strings.Cut(s, "=")
+	if !found {
+		return "", "", &codedError{code: 1}
+	}
+	return before, after, nil
+}
+
+func lookup(key string) (string, *codedError) {
+	if key == "" {
+		return "", &codedError{code: 2}
+	}
+	return strings.ToUpper(key), nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+)
+
+// Values other than the error are discarded.
+func check(s string) error {
+	if _, _, err := split(s); err != nil {
+		return err
+	}
+	if _, err := fmt.Println("valid:", s); err != nil {
+		return err
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return err
+	}
+	fmt.Println(n)
+	return nil
+}
+
+// Errors of imported types are converted, and errors of other types are
+// passed to panic.
+func stat(name string) (fs.FileInfo, *fs.PathError) {
+	info, err := os.Stat(name)
+	if err != nil {
+		if pathError, ok := err.(*fs.PathError); ok {
+			return nil, pathError
+		}
+		panic(err)
+	}
+	return info, nil
+}
+
+// The error variable has the type of the error of lookup, which is declared
+// in another file.
+func upper(key string) (string, error) {
+	value := key
+	if key != "" {
+		var err2 *codedError
+		value, err2 = lookup(key)
+		if err2 != nil {
+			return "", err2
+		}
+	}
+	return value, nil
+}
+
+// err holds the string returned by fmt.Sprint, so the error gets another
+// variable.
+func describe(s string) (int, error) {
+	err := fmt.Sprint("parsing ", s)
+	fmt.Println(err)
+	n, err2 := strconv.Atoi(s)
+	if err2 != nil {
+		return 0, err2
+	}
+	return n, nil
+}
+
+func main() {
+	if err := check(os.Args[1]); err != nil {
+		fmt.Println(err)
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"io"
+	"os"
+	"time"
+)
+
+type name string
+
+type point struct{ x, y int }
+
+type list[T any] []T
+
+type pair[K comparable, V any] struct {
+	key   K
+	value V
+}
+
+type handler = func(string) error
+
+func containers() ([]byte, map[string]int, chan int, <-chan bool, func(), [4]int, error) {
+	if err := os.Remove("tmp"); err != nil {
+		return nil, nil, nil, nil, nil, [4]int{}, err
+	}
+	return nil, nil, nil, nil, nil, [4]int{}, nil
+}
+
+func interfaces() (io.Reader, interface{ Close() error }, any, *os.File, error) {
+	if err := os.Remove("tmp"); err != nil {
+		return *new(io.Reader), nil, nil, nil, err
+	}
+	return nil, nil, nil, nil, nil
+}
+
+func named() (name, point, handler, time.Duration, complex128, error) {
+	if err := os.Remove("tmp"); err != nil {
+		return "", point{}, nil, *new(time.Duration), 0, err
+	}
+	return "", point{}, nil, 0, 0, nil
+}
+
+func generic[T any]() (T, list[T], pair[string, T], struct{ ok bool }, error) {
+	if err := os.Remove("tmp"); err != nil {
+		return *new(T), nil, pair[string, T]{}, struct{ ok bool }{}, err
+	}
+	var zero T
+	return zero, nil, pair[string, T]{}, struct{ ok bool }{}, nil
+}
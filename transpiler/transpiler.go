@@ -4,6 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/aisk/ego/ast"
 	"github.com/aisk/ego/astutil"
@@ -13,416 +17,1829 @@ import (
 	"github.com/aisk/ego/token"
 )
 
-var fstack containers.Stack[*ast.FuncType]
+// function is a function declaration or literal enclosing a try expression.
+type function struct {
+	Type  *ast.FuncType
+	Body  *ast.BlockStmt
+	names map[string]bool // names taken in the function, see newName
+	// The statement being lowered and the names of its error variable and
+	// of its ok variable, see errVarAt and okVarAt.
+	site   *site
+	errVar string
+	okVar  string
+	// The declaration of the function, or nil for a literal, the function
+	// enclosing a literal, and whether a go statement runs the literal.
+	decl      *ast.FuncDecl
+	outer     *function
+	goroutine bool
+}
 
-func preVisit(c *astutil.Cursor) bool {
-	// Push FuncType to a stack for find the enclosing one.
-	n := c.Node()
-	switch x := n.(type) {
-	case *ast.FuncDecl:
-		fstack.Push(x.Type)
-	case *ast.FuncLit:
-		fstack.Push(x.Type)
+// localScope returns the scope of the declarations of the statement being
+// lowered, or of a new block in it if nested is set.
+func (fn *function) localScope(nested bool) *ast.Scope {
+	if fn.site == nil {
+		return ast.NewScope(nil)
 	}
-	return true
+	if nested {
+		return ast.NewScope(fn.site.scope)
+	}
+	return fn.site.scope
 }
 
-func getEnclosingFuncType() (*ast.FuncType, error) {
-	ftype, exist := fstack.Peek()
-	if !exist {
-		return nil, errors.New("no enclosing function")
+// errIsResult reports whether the error variable of fn is its named error
+// result.
+func (fn *function) errIsResult() bool {
+	return errResult(fn.Type) != nil && fn.errVar == errName(fn.Type)
+}
+
+// transpiler holds the state of transpiling a single file.
+type transpiler struct {
+	fset   *token.FileSet
+	file   *ast.File
+	fstack containers.Stack[*function]
+	// Identifiers generated code refers to the packages it needs imported
+	// by, and the names of the packages where theirs are not available,
+	// keyed by path.
+	imports    map[string][]*ast.Ident
+	pkgAliases map[string]string
+	// How errors are propagated from functions without an error result.
+	fallback     Fallback
+	fatalHandler ast.Expr
+	// Function literals run by go statements.
+	goFuncs map[*ast.FuncLit]bool
+	// Try expressions lowered from must and default expressions, see
+	// lowerMustExprs and lowerDefaultExprs.
+	musts    map[*ast.TryExpr]bool
+	defaults map[*ast.TryExpr]*defaultValue
+	// Error variables of try expressions dropping their errors or
+	// propagating errors of concrete types, see errVarOf.
+	errVars map[*ast.TryExpr]string
+	// Declarations of error variables assigned by try expressions, see
+	// lowerAssign and genErrCheck.
+	errDecls map[*ast.DeclStmt]string
+	// Error results set by `defer?` statements, see nameErrResults.
+	deferResults map[*ast.Object]bool
+	// Lines of the removed handle statements, see removeStmt.
+	mergedLines []mergedLines
+	// The bodies of the handle statements, and the copies of them bound to
+	// try expressions, see layoutHandlers.
+	handlers      map[*ast.BlockStmt]*handlerSource
+	handlerCopies map[*ast.BlockStmt]*handlerCopy
+	// Whether propagated errors are annotated, see annotate, and the
+	// function called before they are propagated, or nil.
+	annotations bool
+	hook        *funcRef
+	// Whether `defer?` keeps the error the function returns otherwise, see
+	// lowerDefer.
+	deferFirstError bool
+	// The function making the errors of comma-ok try expressions, or nil,
+	// see genOkErr.
+	okError *funcRef
+	// Error checks generated by genErrCheck, see isErrCheck, and the
+	// continue and break statements of `?continue` and `?break`, along with
+	// the blocks ending with them.
+	checks   map[*ast.IfStmt]bool
+	branches map[*ast.BranchStmt]*ast.BlockStmt
+	// Type information of the file, or nil if it is not type-checked.
+	types *typeInfo
+}
+
+func (t *transpiler) errorf(pos token.Pos, format string, args ...any) error {
+	return fmt.Errorf("%s: %s", t.fset.Position(pos), fmt.Sprintf(format, args...))
+}
+
+// pkgIdent returns an identifier generated code refers to the package path
+// by at the statement being lowered, and records that the file needs the
+// package imported under its name. The name the file imports the package
+// as, or the name of the package if the file does not import it, is used
+// unless a declaration in scope there shadows it or another package takes
+// it; otherwise the package is imported under a name the file does not use.
+func (t *transpiler) pkgIdent(path string) *ast.Ident {
+	name := importName(t.file, path)
+	if name == "" {
+		name = path[strings.LastIndex(path, "/")+1:]
+		if importsAs(t.file, name) {
+			name = ""
+		}
 	}
-	return ftype, nil
+	if name == "" || t.shadowed(name) {
+		if t.pkgAliases[path] == "" {
+			if t.pkgAliases == nil {
+				t.pkgAliases = make(map[string]string)
+			}
+			base := path[strings.LastIndex(path, "/")+1:]
+			alias := base
+			for i := 2; usesName(t.file, alias); i++ {
+				alias = base + strconv.Itoa(i)
+			}
+			t.pkgAliases[path] = alias
+		}
+		name = t.pkgAliases[path]
+	}
+	if t.imports == nil {
+		t.imports = make(map[string][]*ast.Ident)
+	}
+	ident := &ast.Ident{Name: name}
+	t.imports[path] = append(t.imports[path], ident)
+	return ident
 }
 
-func genEmptyValueExpr(field *ast.Field) (ast.Expr, error) {
-	if ident, ok := field.Type.(*ast.Ident); ok {
-		switch field.Type.(*ast.Ident).Name {
-		case "error":
-			return &ast.Ident{Name: "nil"}, nil
-		case "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "float32", "float64", "uintptr", "rune", "byte":
-			return &ast.BasicLit{Kind: token.INT, Value: "0"}, nil
-		case "bool":
-			return &ast.Ident{Name: "false"}, nil
-		case "string":
-			return &ast.BasicLit{Kind: token.STRING, Value: `""`}, nil
-		default:
-			return &ast.StarExpr{
-				X: &ast.CallExpr{
-					Fun: &ast.Ident{Name: "new"},
-					Args: []ast.Expr{
-						&ast.Ident{Name: ident.Name},
-					},
-				},
-			}, nil
-		}
-	} else if selector, ok := field.Type.(*ast.SelectorExpr); ok {
-		return &ast.StarExpr{
-			X: &ast.CallExpr{
-				Fun: &ast.Ident{Name: "new"},
-				Args: []ast.Expr{
-					&ast.SelectorExpr{
-						X:   &ast.Ident{Name: selector.X.(*ast.Ident).Name},
-						Sel: &ast.Ident{Name: selector.Sel.Name},
-					},
-				},
-			},
-		}, nil
-	} else if _, ok := field.Type.(*ast.StarExpr); ok {
-		return &ast.Ident{Name: "nil"}, nil
-	} else {
-		return nil, fmt.Errorf("unhandled result type: %T", field.Type)
+// addImports imports the packages referred to by the identifiers of
+// pkgIdent the file does not import under their names. A package the file
+// does not import is imported once, under another name if it is shadowed
+// somewhere.
+func (t *transpiler) addImports() {
+	for _, path := range slices.Sorted(maps.Keys(t.imports)) {
+		imported := importName(t.file, path)
+		names := make(map[string]bool)
+		for _, ident := range t.imports[path] {
+			if imported == "" && t.pkgAliases[path] != "" {
+				ident.Name = t.pkgAliases[path]
+			}
+			names[ident.Name] = true
+		}
+		for _, name := range slices.Sorted(maps.Keys(names)) {
+			if name == imported {
+				continue
+			}
+			if name == path[strings.LastIndex(path, "/")+1:] {
+				name = ""
+			}
+			astutil.AddNamedImport(t.fset, t.file, name, path)
+		}
 	}
 }
 
-func genResults(results *ast.FieldList) ([]ast.Expr, error) {
-	if results == nil || len(results.List) == 0 {
-		return nil, fmt.Errorf("try expression used in function that does not return an error")
+// shadowed reports whether a declaration other than an import is in scope
+// as name at the statement being lowered, in the enclosing functions or in
+// the package.
+func (t *transpiler) shadowed(name string) bool {
+	if t.file.Scope.Lookup(name) != nil {
+		return true
+	}
+	if t.types != nil && t.types.pkg.Scope().Lookup(name) != nil {
+		return true
+	}
+	fn, err := t.getEnclosingFunc()
+	if err != nil {
+		return false
+	}
+	for site := fn.site; fn != nil; fn = fn.outer {
+		if site != nil {
+			if obj, _ := lookup(site.scope, name); obj != nil {
+				return true
+			}
+		}
+		if fn.outer != nil {
+			site = findSite(fn.outer, stmtOf(fn.outer.Body, fn.Body))
+		}
 	}
+	return false
+}
 
-	fields := results.List
-	var resultsExpr []ast.Expr
+// stmtOf returns the innermost statement of body containing the function
+// literal whose body is lit, or nil if there is none.
+func stmtOf(body, lit *ast.BlockStmt) ast.Stmt {
+	var stack []ast.Node
+	var found ast.Stmt
+	ast.Inspect(body, func(n ast.Node) bool {
+		if found != nil {
+			return false
+		}
+		if n == nil {
+			stack = stack[:len(stack)-1]
+			return false
+		}
+		if x, ok := n.(*ast.FuncLit); ok && x.Body == lit {
+			for _, outer := range slices.Backward(stack) {
+				if s, ok := outer.(ast.Stmt); ok {
+					found = s
+					break
+				}
+			}
+			return false
+		}
+		stack = append(stack, n)
+		return true
+	})
+	return found
+}
 
-	// Check if the last parameter is an error type
-	lastField := fields[len(fields)-1]
-	if ident, ok := lastField.Type.(*ast.Ident); !ok || ident.Name != "error" {
-		return nil, fmt.Errorf("try expression used in function that does not return an error")
+// importsAs reports whether file imports a package under name.
+func importsAs(file *ast.File, name string) bool {
+	for _, spec := range file.Imports {
+		if path, err := strconv.Unquote(spec.Path.Value); err == nil && importName(file, path) == name {
+			return true
+		}
 	}
+	return false
+}
 
-	// Generate empty values for all parameters
-	for _, field := range fields {
-		expr, err := genEmptyValueExpr(field)
-		if err != nil {
-			return nil, err
+// usesName reports whether name is an identifier of file or the name of a
+// package it imports.
+func usesName(file *ast.File, name string) bool {
+	if importsAs(file, name) {
+		return true
+	}
+	used := false
+	ast.Inspect(file, func(n ast.Node) bool {
+		if ident, ok := n.(*ast.Ident); ok && ident.Name == name {
+			used = true
+		}
+		return !used
+	})
+	return used
+}
+
+func (t *transpiler) preVisit(c *astutil.Cursor) bool {
+	// Push functions to a stack for find the enclosing one.
+	n := c.Node()
+	switch x := n.(type) {
+	case *ast.FuncDecl:
+		t.fstack.Push(&function{Type: x.Type, Body: x.Body, decl: x})
+	case *ast.FuncLit:
+		outer, _ := t.fstack.Peek()
+		t.fstack.Push(&function{Type: x.Type, Body: x.Body, outer: outer, goroutine: t.goFuncs[x]})
+	case *ast.GoStmt:
+		if lit, ok := x.Call.Fun.(*ast.FuncLit); ok {
+			if t.goFuncs == nil {
+				t.goFuncs = make(map[*ast.FuncLit]bool)
+			}
+			t.goFuncs[lit] = true
 		}
-		resultsExpr = append(resultsExpr, expr)
 	}
+	return true
+}
 
-	// Replace the last parameter (which is error) with "err"
-	resultsExpr[len(resultsExpr)-1] = &ast.Ident{Name: "err"}
+func (t *transpiler) getEnclosingFunc() (*function, error) {
+	fn, exist := t.fstack.Peek()
+	if !exist {
+		return nil, errors.New("no enclosing function")
+	}
+	return fn, nil
+}
 
-	return resultsExpr, nil
+// hasNamedResults reports whether the results of ftype are named.
+func hasNamedResults(ftype *ast.FuncType) bool {
+	return ftype.Results != nil && len(ftype.Results.List) > 0 && len(ftype.Results.List[0].Names) > 0
 }
 
-func getReaderFileName(reader io.Reader) string {
-	filename := "*unknown*"
-	if f, ok := reader.(interface{ Name() string }); ok {
-		filename = f.Name()
+// errName returns the name of the variable errors are propagated through.
+// It is the name of the error result if the function names its results and
+// the result is of type error, so that deferred functions observe the
+// propagated error.
+func errName(ftype *ast.FuncType) string {
+	if hasNamedResults(ftype) {
+		last := ftype.Results.List[len(ftype.Results.List)-1]
+		if name := last.Names[len(last.Names)-1].Name; name != "_" && isError(last.Type) {
+			return name
+		}
 	}
-	return filename
+	return "err"
 }
 
-func Transpile(input io.Reader, output io.Writer) error {
-	fset := token.NewFileSet()
-	file, err := parser.ParseFile(fset, getReaderFileName(input), input, 0)
-	if err != nil {
-		return err
+// genErrExpr generates the error value propagated by x, whose error is
+// errExpr. A plain `?` returns the error as is, while `?("message", args...)`
+// wraps it with fmt.Errorf.
+func (t *transpiler) genErrExpr(x *ast.TryExpr, errExpr ast.Expr) (ast.Expr, error) {
+	if len(x.Args) == 0 {
+		return errExpr, nil
 	}
 
-	// ast.Print(fset, file)
+	msg, ok := x.Args[0].(*ast.BasicLit)
+	if !ok || msg.Kind != token.STRING {
+		return nil, t.errorf(x.Args[0].Pos(), "error wrap message must be a string literal")
+	}
+	// Insert ": %w" before the closing quote, which works for both
+	// interpreted and raw string literals.
+	format := &ast.BasicLit{
+		Kind:  token.STRING,
+		Value: msg.Value[:len(msg.Value)-1] + ": %w" + msg.Value[len(msg.Value)-1:],
+	}
 
-	var transpileError error
+	args := []ast.Expr{format}
+	args = append(args, x.Args[1:]...)
+	args = append(args, errExpr)
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   t.pkgIdent("fmt"),
+			Sel: &ast.Ident{Name: "Errorf"},
+		},
+		Args: args,
+	}, nil
+}
 
-	astutil.Apply(file, preVisit, func(c *astutil.Cursor) bool {
-		n := c.Node()
-		switch x := n.(type) {
-		case *ast.FuncDecl, *ast.FuncLit:
-			// Pop the FuncType stack.
-			fstack.Pop()
-		case *ast.AssignStmt:
-			// Handle err := f()?
-			rhs, ok := x.Rhs[0].(*ast.TryExpr)
-			if !ok {
-				break
-			}
-			enclosingFunc, err := getEnclosingFuncType()
-			if err != nil {
-				transpileError = fmt.Errorf("%s: %v", fset.Position(x.Pos()), err)
-				return false
+// genResults generates the results of the return statement propagating
+// errExpr. Named results are returned as they are, so partial results are
+// not discarded; unnamed ones are returned as zero values.
+func (t *transpiler) genResults(results *ast.FieldList, errExpr ast.Expr) []ast.Expr {
+	var resultsExpr []ast.Expr
+	for _, field := range results.List {
+		if len(field.Names) == 0 {
+			resultsExpr = append(resultsExpr, t.genZeroValue(field.Type))
+			continue
+		}
+		for _, name := range field.Names {
+			if name.Name == "_" {
+				resultsExpr = append(resultsExpr, t.genZeroValue(field.Type))
+			} else {
+				resultsExpr = append(resultsExpr, &ast.Ident{Name: name.Name})
 			}
+		}
+	}
 
-			results, err := genResults(enclosingFunc.Results)
-			if err != nil {
-				transpileError = fmt.Errorf("%s: %v", fset.Position(x.Pos()), err)
-				return false
-			}
+	// Replace the last result, which is the error, with the propagated error
+	resultsExpr[len(resultsExpr)-1] = errExpr
 
-			x.Rhs[0] = rhs.X
-			x.Lhs = append(x.Lhs, &ast.Ident{Name: "err"})
+	return resultsExpr
+}
 
-			c.InsertAfter(&ast.IfStmt{
-				Cond: &ast.BinaryExpr{
-					X:  &ast.Ident{Name: "err"},
-					Op: token.NEQ,
-					Y:  &ast.Ident{Name: "nil"},
-				},
-				Body: &ast.BlockStmt{
-					List: []ast.Stmt{
-						&ast.ReturnStmt{
-							Results: results,
-						},
-					},
-				}})
-		case *ast.ExprStmt:
-			// Handle f()?
-			tryX, ok := x.X.(*ast.TryExpr)
-			if !ok {
-				break
+// genErrCheck generates the `if err != nil { return ... }` statement
+// propagating the error of x from fn. With named results a bare return is
+// enough, unless the error result is shadowed by the checked error variable
+// or the error is wrapped. The error of a must expression is passed to
+// panic instead, and the error of a try expression with a handler is
+// handled by the handler, which assigns the default value of a default
+// expression. A comma-ok try expression checks its ok value instead, see
+// genOkErr.
+func (t *transpiler) genErrCheck(fn *function, x *ast.TryExpr, shadowed bool) (*ast.IfStmt, error) {
+	errVar := t.errVarOf(fn, x)
+	if x.BranchPos.IsValid() {
+		return t.genBranch(fn, x, errVar)
+	}
+	if x.Handler != nil {
+		if t.defaults[x] == nil {
+			if err := t.checkHandler(x.Err, x.Handler); err != nil {
+				return nil, err
 			}
-
-			enclosingFunc, err := getEnclosingFuncType()
+		}
+		body := x.Handler
+		if t.defaults[x] != nil {
+			t.dropErrDecls(fn, body, errVar)
+		}
+		if t.isCommaOk(x) {
+			if err := t.declareOkErr(fn, x); err != nil {
+				return nil, err
+			}
+		} else if len(x.Args) > 0 || t.isBound(x) && t.annotations {
+			// A handler bound by a handle statement receives the wrapped
+			// and annotated error.
+			errExpr, err := t.genErrExpr(x, &ast.Ident{Name: errVar})
 			if err != nil {
-				transpileError = fmt.Errorf("%s: %v", fset.Position(x.Pos()), err)
-				return false
+				return nil, err
+			}
+			if t.isBound(x) {
+				errExpr = t.annotate(fn, x, errExpr)
 			}
+			wrap := &ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.Ident{Name: errVar}},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{errExpr},
+			}
+			setPos(wrap, body.Lbrace)
+			body.List = append([]ast.Stmt{wrap}, body.List...)
+		}
+		if t.hook != nil && t.isBound(x) && !t.isCommaOk(x) {
+			// The hook is called with the error before it is wrapped, as
+			// the error is propagated to the handle statement.
+			hook := t.genHook(fn, x, errVar)
+			setPos(hook, body.Lbrace)
+			body.List = append([]ast.Stmt{hook}, body.List...)
+		}
+		return t.newErrCheck(t.genErrCond(x, errVar), body), nil
+	}
+	var list []ast.Stmt
+	var errExpr ast.Expr = &ast.Ident{Name: errVar}
+	if t.isCommaOk(x) {
+		errExpr = t.genOkErr(fn, x)
+		if t.hook != nil && !t.musts[x] {
+			// The hook and the return statement share the error.
+			tok := token.DEFINE
+			if fn.errIsResult() {
+				tok = token.ASSIGN
+			}
+			list = append(list, &ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.Ident{Name: fn.errVar}},
+				Tok: tok,
+				Rhs: []ast.Expr{errExpr},
+			})
+			errVar = fn.errVar
+			errExpr = &ast.Ident{Name: errVar}
+		}
+	}
+	errExpr, err := t.genErrExpr(x, errExpr)
+	if err != nil {
+		return nil, err
+	}
 
-			results, err := genResults(enclosingFunc.Results)
-			if err != nil {
-				transpileError = fmt.Errorf("%s: %v", fset.Position(x.Pos()), err)
-				return false
+	var stmts []ast.Stmt
+	if t.musts[x] {
+		stmts = []ast.Stmt{genPanic(errExpr)}
+	} else if t.hasErrResult(fn.Type) {
+		typ, err := t.errResultType(fn.Type)
+		if err != nil {
+			return nil, t.errorf(x.Pos(), "%v", err)
+		}
+		if isError(typ) {
+			// Errors of other types cannot be annotated.
+			errExpr = t.annotate(fn, x, errExpr)
+		}
+		converted, err := t.convertErr(x, errExpr, typ)
+		if err != nil {
+			return nil, err
+		}
+		if assert, ok := converted.(*ast.TypeAssertExpr); ok {
+			stmts = t.genAssertedReturn(fn, errExpr, assert)
+		} else {
+			results := t.genResults(fn.Type.Results, converted)
+			if ident, plain := converted.(*ast.Ident); plain && ident.Name == fn.errVar && !shadowed && fn.errIsResult() {
+				results = nil
 			}
+			stmts = []ast.Stmt{&ast.ReturnStmt{Results: results}}
+		}
+	} else if stmt := t.genFallback(fn, t.annotate(fn, x, errExpr)); stmt != nil {
+		stmts = []ast.Stmt{stmt}
+	} else {
+		_, err := t.errResultType(fn.Type)
+		return nil, t.errorf(x.Pos(), "%v", err)
+	}
+	if t.hook != nil && !t.musts[x] {
+		list = append(list, t.genHook(fn, x, errVar))
+	}
+	list = append(list, stmts...)
 
-			c.Replace(&ast.IfStmt{
-				Init: &ast.AssignStmt{
-					Lhs: []ast.Expr{
-						&ast.Ident{Name: "err"},
-					},
-					Tok: token.DEFINE,
-					Rhs: []ast.Expr{
-						tryX.X,
-					},
-				},
-				Cond: &ast.BinaryExpr{
-					X:  &ast.Ident{Name: "err"},
-					Op: token.NEQ,
-					Y:  &ast.Ident{Name: "nil"},
-				},
-				Body: &ast.BlockStmt{
-					List: []ast.Stmt{
-						&ast.ReturnStmt{
-							Results: results,
-						},
-					},
-				},
-			})
-		case *ast.IfStmt:
-			// Handle if statements with TryExpr in condition
-			// Specifically handle the pattern: if f()? > 0 { ... }
-			if tryExpr := findTopLevelTryExpr(x.Cond); tryExpr != nil {
-				enclosingFunc, err := getEnclosingFuncType()
-				if err != nil {
-					transpileError = fmt.Errorf("%s: %v", fset.Position(x.Pos()), err)
-					return false
-				}
+	return t.newErrCheck(t.genErrCond(x, t.errVarOf(fn, x)), &ast.BlockStmt{List: list}), nil
+}
 
-				results, err := genResults(enclosingFunc.Results)
-				if err != nil {
-					transpileError = fmt.Errorf("%s: %v", fset.Position(x.Pos()), err)
-					return false
-				}
+// newErrCheck returns the error check with the condition cond and the body
+// body, which isErrCheck recognizes.
+func (t *transpiler) newErrCheck(cond ast.Expr, body *ast.BlockStmt) *ast.IfStmt {
+	check := &ast.IfStmt{Cond: cond, Body: body}
+	if t.checks == nil {
+		t.checks = make(map[*ast.IfStmt]bool)
+	}
+	t.checks[check] = true
+	return check
+}
 
-				// Replace the TryExpr with a variable
-				newCond := replaceTryExpr(x.Cond, tryExpr, "result")
-
-				// Create the new if statement with init
-				newIf := &ast.IfStmt{
-					Init: &ast.AssignStmt{
-						Lhs: []ast.Expr{
-							&ast.Ident{Name: "result"},
-							&ast.Ident{Name: "err"},
-						},
-						Tok: token.DEFINE,
-						Rhs: []ast.Expr{tryExpr.X},
-					},
-					Cond: &ast.BinaryExpr{
-						X:  &ast.Ident{Name: "err"},
-						Op: token.NEQ,
-						Y:  &ast.Ident{Name: "nil"},
-					},
-					Body: &ast.BlockStmt{
-						List: []ast.Stmt{
-							&ast.ReturnStmt{Results: results},
-						},
-					},
-					Else: &ast.IfStmt{
-						Cond: newCond,
-						Body: x.Body,
-						Else: x.Else,
-					},
-				}
+// genErrCond generates the condition of the error check of x, whose error
+// is held by errVar, or its ok value by a comma-ok try expression.
+func (t *transpiler) genErrCond(x *ast.TryExpr, errVar string) ast.Expr {
+	if t.isCommaOk(x) {
+		return &ast.UnaryExpr{Op: token.NOT, X: &ast.Ident{Name: errVar}}
+	}
+	return &ast.BinaryExpr{
+		X:  &ast.Ident{Name: errVar},
+		Op: token.NEQ,
+		Y:  &ast.Ident{Name: "nil"},
+	}
+}
 
-				// Handle init statement if it exists
-				if x.Init != nil {
-					// If there's an init statement, we need to create a new if statement
-					// that incorporates both the init and the error handling
-					newIf.Init = x.Init
+// hoistTryExprs replaces every try expression in x with a temporary and
+// returns the statements declaring and checking the temporaries, in
+// evaluation order. Operands with side effects evaluated before a try
+// expression are stored in temporaries too, so they are still evaluated
+// first. The statements are declared in a block that is not the outermost
+// block of fn if shadowed is set.
+func (t *transpiler) hoistTryExprs(fn *function, x ast.Expr, shadowed bool) (ast.Expr, []ast.Stmt, error) {
+	var stmts []ast.Stmt
+	var hoistErr error
+	before := operandsBefore(x)
+	x = astutil.Apply(x, func(c *astutil.Cursor) bool {
+		switch x := c.Node().(type) {
+		case *ast.FuncLit:
+			// Try expressions in function literals belong to the literal.
+			return false
+		case *ast.BinaryExpr:
+			if (x.Op == token.LAND || x.Op == token.LOR) && containsTryExpr(x.Y) {
+				cond, condStmts, err := t.hoistCondExpr(fn, x, shadowed)
+				if err != nil {
+					hoistErr = err
+					return false
 				}
-
-				c.Replace(newIf)
+				stmts = append(stmts, condStmts...)
+				c.Replace(cond)
+				return false
+			}
+		}
+		return true
+	}, func(c *astutil.Cursor) bool {
+		tryX, ok := c.Node().(*ast.TryExpr)
+		if !ok {
+			if x, ok := c.Node().(ast.Expr); ok && before[x] && hasSideEffects(x) {
+				temp, assign := t.hoistValue(fn, x)
+				stmts = append(stmts, assign)
+				c.Replace(temp)
 			}
+			return true
 		}
+		errCheck, err := t.genErrCheck(fn, tryX, shadowed)
+		if err != nil {
+			hoistErr = err
+			return false
+		}
+
+		temp := t.newName(fn, baseName(tryX.X))
+		t.setDefault(tryX, &ast.Ident{Name: temp})
+		assign := &ast.AssignStmt{
+			Lhs: []ast.Expr{
+				&ast.Ident{Name: temp},
+				&ast.Ident{Name: t.errVarOf(fn, tryX)},
+			},
+			Tok: token.DEFINE,
+			Rhs: []ast.Expr{tryX.X},
+		}
+		setPos(assign, tryX.Pos())
+		setPos(errCheck, checkPos(tryX))
+		stmts = append(stmts, assign, errCheck)
 
+		c.Replace(&ast.Ident{NamePos: tryX.Pos(), Name: temp})
 		return true
-	})
+	}).(ast.Expr)
+	return x, stmts, hoistErr
+}
 
-	if transpileError != nil {
-		return transpileError
+// hoistValue returns a temporary holding the value of x, and the statement
+// declaring it.
+func (t *transpiler) hoistValue(fn *function, x ast.Expr) (*ast.Ident, ast.Stmt) {
+	temp := t.newName(fn, baseName(x))
+	assign := &ast.AssignStmt{
+		Lhs: []ast.Expr{&ast.Ident{Name: temp}},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{x},
 	}
+	setPos(assign, x.Pos())
+	return &ast.Ident{NamePos: x.Pos(), Name: temp}, assign
+}
 
-	return format.Node(output, fset, file)
+// operandsBefore collects the operands in x that are evaluated before a try
+// expression following them, as a() in `a() + b()?`.
+func operandsBefore(x ast.Expr) map[ast.Expr]bool {
+	before := make(map[ast.Expr]bool)
+	var visit func(x ast.Expr)
+	visit = func(x ast.Expr) {
+		ops := operands(x)
+		last := -1
+		for i, op := range ops {
+			if containsTryExpr(op) {
+				last = i
+			}
+		}
+		for i, op := range ops[:last+1] {
+			before[op] = i < last
+			if containsTryExpr(op) {
+				visit(op)
+			}
+		}
+	}
+	visit(x)
+	return before
+}
+
+// operands returns the operands of x in evaluation order. The keys and
+// values of composite literals are operands of their own, and the operand
+// of a try expression is the expression it checks.
+func operands(x ast.Expr) []ast.Expr {
+	switch x := x.(type) {
+	case *ast.FuncLit:
+		return nil
+	case *ast.TryExpr:
+		return []ast.Expr{x.X}
+	}
+	var ops []ast.Expr
+	ast.Inspect(x, func(n ast.Node) bool {
+		if n == x {
+			return true
+		}
+		if kv, ok := n.(*ast.KeyValueExpr); ok {
+			ops = append(ops, kv.Key, kv.Value)
+		} else if op, ok := n.(ast.Expr); ok {
+			ops = append(ops, op)
+		}
+		return false
+	})
+	return ops
 }
 
-// containsTryExpr checks if an expression contains any TryExpr nodes
-func containsTryExpr(expr ast.Expr) bool {
+// hasSideEffects reports whether evaluating x may call a function or
+// receive from a channel. Calls of predeclared functions without side
+// effects and conversions to predeclared types are not counted.
+func hasSideEffects(x ast.Expr) bool {
 	found := false
-	ast.Inspect(expr, func(n ast.Node) bool {
-		if _, ok := n.(*ast.TryExpr); ok {
-			found = true
+	ast.Inspect(x, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.FuncLit:
 			return false
+		case *ast.CallExpr:
+			ident, ok := ast.Unparen(n.Fun).(*ast.Ident)
+			found = !ok || ident.Obj != nil || !pure[ident.Name]
+		case *ast.UnaryExpr:
+			found = n.Op == token.ARROW
 		}
-		return true
+		return !found
 	})
 	return found
 }
 
-// transformTryExpr transforms an expression containing TryExpr into a new expression
-// and returns the assignments needed to handle error checking
-func transformTryExpr(expr ast.Expr, prefix string, results []ast.Expr) (ast.Expr, []ast.Stmt) {
-	var assignments []ast.Stmt
-
-	// Create a map to track TryExpr replacements
-	tryReplacements := make(map[*ast.TryExpr]string)
-
-	// First pass: collect all TryExpr nodes and create replacement variables
-	ast.Inspect(expr, func(n ast.Node) bool {
-		if tryExpr, ok := n.(*ast.TryExpr); ok {
-			if _, exists := tryReplacements[tryExpr]; !exists {
-				varName := fmt.Sprintf("%s%d", prefix, len(tryReplacements))
-				tryReplacements[tryExpr] = varName
+// hoistCondExpr hoists the try expressions in the && or || expression x.
+// Its right operand is only evaluated when x is not decided by its left
+// operand, so the try expressions of the right operand are hoisted into an
+// if statement checking the left operand.
+func (t *transpiler) hoistCondExpr(fn *function, x *ast.BinaryExpr, shadowed bool) (ast.Expr, []ast.Stmt, error) {
+	left, stmts, err := t.hoistTryExprs(fn, x.X, shadowed)
+	if err != nil {
+		return nil, nil, err
+	}
+	temp := t.newName(fn, "cond")
+	right, rightStmts, err := t.hoistTryExprs(fn, x.Y, true)
+	if err != nil {
+		return nil, nil, err
+	}
 
-				// Create assignment statement
-				assign := &ast.AssignStmt{
-					Lhs: []ast.Expr{
-						&ast.Ident{Name: varName},
-						&ast.Ident{Name: "err"},
-					},
-					Tok: token.DEFINE,
-					Rhs: []ast.Expr{tryExpr.X},
-				}
+	var cond ast.Expr = &ast.Ident{Name: temp}
+	if x.Op == token.LOR {
+		cond = negate(cond)
+	}
+	assign := &ast.AssignStmt{
+		Lhs: []ast.Expr{&ast.Ident{Name: temp}},
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{left},
+	}
+	evalRight := &ast.IfStmt{
+		Cond: cond,
+		Body: &ast.BlockStmt{
+			List: append(rightStmts, &ast.AssignStmt{
+				Lhs: []ast.Expr{&ast.Ident{Name: temp}},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{right},
+			}),
+		},
+	}
+	setPos(assign, x.Pos())
+	setPos(evalRight, x.OpPos)
+	return &ast.Ident{NamePos: x.Pos(), Name: temp}, append(stmts, assign, evalRight), nil
+}
 
-				// Create error check
-				errCheck := &ast.IfStmt{
-					Cond: &ast.BinaryExpr{
-						X:  &ast.Ident{Name: "err"},
-						Op: token.NEQ,
-						Y:  &ast.Ident{Name: "nil"},
-					},
-					Body: &ast.BlockStmt{
-						List: []ast.Stmt{
-							&ast.ReturnStmt{Results: results},
-						},
-					},
-				}
+// rewriteLoop lowers the try expressions in the header of loop. Values of
+// the range expression and the init statement are computed before the loop,
+// while the condition and the post statement are evaluated in the body on
+// every iteration. The returned statements are inserted before the loop.
+func (t *transpiler) rewriteLoop(fn *function, loop ast.Stmt, label *ast.Ident, shadowed bool) ([]ast.Stmt, error) {
+	var before []ast.Stmt
+	switch x := loop.(type) {
+	case *ast.RangeStmt:
+		if !containsTryExpr(x.X) {
+			return nil, nil
+		}
+		rangeX, stmts, err := t.hoistTryExprs(fn, x.X, shadowed)
+		if err != nil {
+			return nil, err
+		}
+		x.X = rangeX
+		before = stmts
 
-				assignments = append(assignments, assign, errCheck)
+	case *ast.ForStmt:
+		if x.Init != nil && containsTryExpr(x.Init) {
+			init, stmts, err := t.hoistStmt(fn, x.Init, shadowed)
+			if err != nil {
+				return nil, err
 			}
+			x.Init = init
+			before = stmts
 		}
-		return true
-	})
 
-	// Second pass: create a new expression with TryExpr replaced
-	// We need to create a deep copy of the expression
-	// For now, we'll use a simple approach by walking and replacing
-	var transformExpr func(ast.Expr) ast.Expr
-	transformExpr = func(e ast.Expr) ast.Expr {
-		switch v := e.(type) {
-		case *ast.TryExpr:
-			if varName, exists := tryReplacements[v]; exists {
-				return &ast.Ident{Name: varName}
-			}
-			return v
-		case *ast.BinaryExpr:
-			return &ast.BinaryExpr{
-				X:  transformExpr(v.X),
-				Op: v.Op,
-				Y:  transformExpr(v.Y),
+		var head, tail []ast.Stmt
+		if x.Cond != nil && containsTryExpr(x.Cond) {
+			cond, stmts, err := t.hoistTryExprs(fn, x.Cond, true)
+			if err != nil {
+				return nil, err
 			}
-		case *ast.UnaryExpr:
-			return &ast.UnaryExpr{
-				Op: v.Op,
-				X:  transformExpr(v.X),
+			brk := &ast.IfStmt{
+				Cond: negate(cond),
+				Body: &ast.BlockStmt{
+					List: []ast.Stmt{&ast.BranchStmt{Tok: token.BREAK}},
+				},
 			}
-		case *ast.ParenExpr:
-			return &ast.ParenExpr{X: transformExpr(v.X)}
-		case *ast.CallExpr:
-			fun := transformExpr(v.Fun)
-			args := make([]ast.Expr, len(v.Args))
-			for i, arg := range v.Args {
-				args[i] = transformExpr(arg)
+			setPos(brk, x.Cond.End())
+			head = append(stmts, brk)
+			x.Cond = nil
+		}
+		if x.Post != nil && containsTryExpr(x.Post) {
+			// The post statement moves to the end of the body, which a
+			// continue statement would skip, so it is also run before the
+			// continue statements of the loop.
+			continues := findContinues(x.Body, label)
+			post, stmts, err := t.hoistStmt(fn, x.Post, true)
+			if err != nil {
+				return nil, err
 			}
-			return &ast.CallExpr{Fun: fun, Args: args}
-		default:
-			return v
+			if post != nil {
+				stmts = append(stmts, post)
+			}
+			// Move the statements from the header to the end of the body.
+			for _, stmt := range stmts {
+				stmt = cloneNode(stmt)
+				setPos(stmt, x.Body.Rbrace)
+				tail = append(tail, stmt)
+			}
+			t.insertBeforeContinues(x.Body, continues, tail)
+			x.Post = nil
+		}
+		if head != nil || tail != nil {
+			list := append(head, x.Body.List...)
+			x.Body.List = append(list, tail...)
 		}
 	}
-
-	newExpr := transformExpr(expr)
-	return newExpr, assignments
+	return before, nil
 }
 
-// findTopLevelTryExpr finds the top-level TryExpr in an expression
-func findTopLevelTryExpr(expr ast.Expr) *ast.TryExpr {
-	switch v := expr.(type) {
-	case *ast.TryExpr:
-		return v
-	case *ast.BinaryExpr:
-		// Check both sides of binary expression
-		if left := findTopLevelTryExpr(v.X); left != nil {
-			return left
+// insertBeforeContinues inserts copies of stmts before the continue
+// statements continues in body. A continue statement of the source that
+// does not end a nested block of body moves into a block of its own along
+// with the copies, which may declare variables the body declares too.
+func (t *transpiler) insertBeforeContinues(body *ast.BlockStmt, continues []*ast.BranchStmt, stmts []ast.Stmt) {
+	copies := func(branch *ast.BranchStmt) []ast.Stmt {
+		var list []ast.Stmt
+		for _, stmt := range stmts {
+			stmt = cloneNode(stmt)
+			setPos(stmt, branch.Pos())
+			list = append(list, stmt)
 		}
-		return findTopLevelTryExpr(v.Y)
-	case *ast.ParenExpr:
-		return findTopLevelTryExpr(v.X)
-	case *ast.UnaryExpr:
-		return findTopLevelTryExpr(v.X)
-	case *ast.CallExpr:
-		// Check function and arguments
-		if fun := findTopLevelTryExpr(v.Fun); fun != nil {
-			return fun
+		return append(list, branch)
+	}
+	plain := make(map[*ast.BranchStmt]bool)
+	for _, branch := range continues {
+		// The continue statement of `?continue` ends the block of its
+		// check.
+		if block := t.branches[branch]; block != nil {
+			n := len(block.List) - 1
+			block.List = append(block.List[:n:n], copies(branch)...)
+			continue
+		}
+		plain[branch] = true
+	}
+	if len(plain) == 0 {
+		return
+	}
+	astutil.Apply(body, func(c *astutil.Cursor) bool {
+		branch, ok := c.Node().(*ast.BranchStmt)
+		if !ok || !plain[branch] {
+			return true
+		}
+		if c.Index() < 0 || c.Parent() == body {
+			block := &ast.BlockStmt{Lbrace: branch.Pos(), List: copies(branch), Rbrace: branch.End()}
+			c.Replace(block)
+			return false
+		}
+		for _, stmt := range copies(branch)[:len(stmts)] {
+			c.InsertBefore(stmt)
 		}
-		for _, arg := range v.Args {
-			if try := findTopLevelTryExpr(arg); try != nil {
-				return try
+		return false
+	}, nil)
+}
+
+// rewriteIf lowers the try expressions in the init statements and the
+// conditions of the chain of if statements starting with x. Each check of a
+// hoisted error becomes an if statement of the chain, which keeps the
+// variables of the init statement scoped to the chain and evaluates the
+// conditions of else-if statements only when reached. Other hoisted
+// statements go into a block in the else branch, or before x if hoist is set
+// and they come first. The returned statement replaces x.
+func (t *transpiler) rewriteIf(fn *function, x *ast.IfStmt, hoist bool) (ast.Stmt, []ast.Stmt, error) {
+	var steps []ast.Stmt
+	// The init statement, if it is a step, declares variables that must
+	// stay scoped to the chain.
+	var scoped ast.Stmt
+	condTry := containsTryExpr(x.Cond)
+	if x.Init != nil && containsTryExpr(x.Init) {
+		stmts, err := t.lowerStmt(fn, x.Init)
+		if err != nil {
+			return nil, nil, err
+		}
+		x.Init = nil
+		last := stmts[len(stmts)-1]
+		check, isCheck := last.(*ast.IfStmt)
+		switch {
+		case isCheck && t.isErrCheck(check):
+		case isCheck && t.checks[check]:
+			// A check falling through cannot start the chain, and the
+			// variables of the assignment it checks stay scoped to it.
+			scoped = last
+			if check.Init == nil && len(stmts) > 1 {
+				scoped = stmts[len(stmts)-2]
 			}
+		case condTry:
+			// The condition may refer to the variables of the init
+			// statement, which must precede its hoisted statements.
+			scoped = last
+		default:
+			x.Init = last
+			stmts = stmts[:len(stmts)-1]
 		}
+		steps = stmts
+	} else if x.Init != nil && condTry {
+		steps = []ast.Stmt{x.Init}
+		scoped = x.Init
+		x.Init = nil
+	}
+	if condTry {
+		cond, stmts, err := t.hoistTryExprs(fn, x.Cond, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		x.Cond = cond
+		steps = append(steps, stmts...)
+	}
+
+	if elseIf, ok := x.Else.(*ast.IfStmt); ok {
+		// Conditions are lowered in order, so that temporaries are numbered
+		// in order too.
+		stmt, _, err := t.rewriteIf(fn, elseIf, false)
+		if err != nil {
+			return nil, nil, err
+		}
+		x.Else = stmt
+	}
+	if len(steps) == 0 {
+		return x, nil, nil
 	}
-	return nil
-}
 
-// replaceTryExpr replaces a specific TryExpr with a variable name
-func replaceTryExpr(expr ast.Expr, oldExpr *ast.TryExpr, varName string) ast.Expr {
-	if expr == oldExpr {
-		return &ast.Ident{Name: varName}
+	var before []ast.Stmt
+	for hoist && len(steps) > 0 && steps[0] != scoped && !t.isErrCheck(steps[0]) && !t.isErrCheckAssign(steps) {
+		before = append(before, steps[0])
+		steps = steps[1:]
 	}
 
-	switch v := expr.(type) {
-	case *ast.BinaryExpr:
-		return &ast.BinaryExpr{
-			X:  replaceTryExpr(v.X, oldExpr, varName),
-			Op: v.Op,
-			Y:  replaceTryExpr(v.Y, oldExpr, varName),
+	var result ast.Stmt = x
+	var block *ast.BlockStmt
+	for i := len(steps) - 1; i >= 0; i-- {
+		if check, ok := steps[i].(*ast.IfStmt); ok && t.isErrCheck(check) {
+			if check.Init == nil && i > 0 {
+				check.Init = steps[i-1]
+				i--
+			}
+			check.Else = result
+			result = check
+			block = nil
+			continue
 		}
+		if block == nil {
+			block = &ast.BlockStmt{Lbrace: steps[i].Pos(), List: []ast.Stmt{result}, Rbrace: result.End()}
+			result = block
+		} else {
+			block.Lbrace = steps[i].Pos()
+		}
+		block.List = append([]ast.Stmt{steps[i]}, block.List...)
+	}
+	if first, ok := result.(*ast.IfStmt); ok && first != x {
+		// Leading comments stay before the chain.
+		first.If = x.If
+		x.If = x.Cond.Pos()
+	}
+	return result, before, nil
+}
+
+// isErrCheck reports whether s is an error check generated by genErrCheck
+// whose body does not fall through, so that the statements following it
+// may go into its else branch. The check of a default expression falls
+// through.
+func (t *transpiler) isErrCheck(s ast.Stmt) bool {
+	check, ok := s.(*ast.IfStmt)
+	return ok && t.checks[check] && check.Else == nil && isTerminating(check.Body)
+}
+
+// isErrCheckAssign reports whether stmts start with an assignment followed
+// by the error check of the assigned error.
+func (t *transpiler) isErrCheckAssign(stmts []ast.Stmt) bool {
+	if len(stmts) < 2 {
+		return false
+	}
+	check, ok := stmts[1].(*ast.IfStmt)
+	return ok && check.Init == nil && t.isErrCheck(check)
+}
+
+// rewriteSwitch lowers the try expressions in the header of the switch
+// statement s, which is stmt or labeled by stmt. The init statement and the
+// tag are evaluated once, so their values are computed before the switch.
+// When the tag may refer to variables of the init statement, both move into
+// a block enclosing stmt instead, keeping the variables scoped to the
+// switch. The returned statement replaces stmt, and the returned statements
+// are inserted before it.
+func (t *transpiler) rewriteSwitch(fn *function, s, stmt ast.Stmt, shadowed bool) (ast.Stmt, []ast.Stmt, error) {
+	var init *ast.Stmt
+	var tag *ast.Expr
+	switch x := s.(type) {
+	case *ast.SwitchStmt:
+		init = &x.Init
+		if x.Tag != nil {
+			tag = &x.Tag
+		}
+	case *ast.TypeSwitchStmt:
+		init = &x.Init
+		tag = typeSwitchX(x.Assign)
+	}
+	initTry := *init != nil && containsTryExpr(*init)
+	tagTry := tag != nil && containsTryExpr(*tag)
+
+	if *init != nil && tagTry {
+		list, err := t.lowerStmt(fn, *init)
+		if err != nil {
+			return nil, nil, err
+		}
+		*init = nil
+		stmts, err := t.hoistExprs(fn, true, tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		list = append(list, stmts...)
+		block := &ast.BlockStmt{
+			Lbrace: stmt.Pos(),
+			List:   append(list, stmt),
+			Rbrace: stmt.End(),
+		}
+		return block, nil, nil
+	}
+
+	var before []ast.Stmt
+	if initTry {
+		hoisted, stmts, err := t.hoistStmt(fn, *init, shadowed)
+		if err != nil {
+			return nil, nil, err
+		}
+		*init = hoisted
+		before = stmts
+	}
+	if tagTry {
+		stmts, err := t.hoistExprs(fn, shadowed, tag)
+		if err != nil {
+			return nil, nil, err
+		}
+		before = append(before, stmts...)
+	}
+	return stmt, before, nil
+}
+
+// lowerStmt lowers the try expressions of the simple statement s, which
+// moves into a nested block, into a list of statements.
+func (t *transpiler) lowerStmt(fn *function, s ast.Stmt) ([]ast.Stmt, error) {
+	if !containsTryExpr(s) {
+		return []ast.Stmt{s}, nil
+	}
+	if x, ok := s.(*ast.AssignStmt); ok {
+		if rhs := tryAssign(x); rhs != nil {
+			before, after, err := t.lowerAssign(fn, x, rhs, true, fn.localScope(true))
+			if err != nil {
+				return nil, err
+			}
+			return append(append(before, x), after...), nil
+		}
+	}
+	hoisted, stmts, err := t.hoistStmt(fn, s, true)
+	if err != nil {
+		return nil, err
+	}
+	if hoisted != nil {
+		stmts = append(stmts, hoisted)
+	}
+	return stmts, nil
+}
+
+// typeSwitchX returns the expression whose type is switched on by the type
+// switch guard assign, or nil if the guard is invalid.
+func typeSwitchX(assign ast.Stmt) *ast.Expr {
+	var x ast.Expr
+	switch s := assign.(type) {
+	case *ast.AssignStmt:
+		if len(s.Rhs) == 1 {
+			x = s.Rhs[0]
+		}
+	case *ast.ExprStmt:
+		x = s.X
+	}
+	if assert, ok := x.(*ast.TypeAssertExpr); ok {
+		return &assert.X
+	}
+	return nil
+}
+
+// hoistStmt hoists the try expressions in the expressions of s, which is a
+// simple statement or a go, defer, return or declaration statement. The returned
+// statement is nil if nothing remains of s.
+func (t *transpiler) hoistStmt(fn *function, s ast.Stmt, shadowed bool) (ast.Stmt, []ast.Stmt, error) {
+	var exprs []*ast.Expr
+	switch s := s.(type) {
+	case *ast.ExprStmt:
+		if tryX, ok := s.X.(*ast.TryExpr); ok {
+			if t.defaults[tryX] != nil {
+				return nil, nil, t.errorf(tryX.Pos(), "default expression is not used")
+			}
+			// The value is discarded: check the error only.
+			stmts, err := t.hoistExprs(fn, shadowed, &tryX.X)
+			if err != nil {
+				return nil, nil, err
+			}
+			errCheck, err := t.genErrCheck(fn, tryX, shadowed)
+			if err != nil {
+				return nil, nil, err
+			}
+			// A named error result is assigned, a local one is scoped to
+			// the if statement.
+			tok := token.DEFINE
+			if fn.errIsResult() && tryX.Handler == nil && t.errVarOf(fn, tryX) == fn.errVar {
+				tok = token.ASSIGN
+			}
+			// Other values are discarded when they are known, and the
+			// value of a comma-ok try expression always.
+			var lhs []ast.Expr
+			if t.isCommaOk(tryX) {
+				lhs = append(lhs, &ast.Ident{Name: "_"})
+			} else if values := t.tryValues(tryX); len(values) > 1 {
+				for range values[1:] {
+					lhs = append(lhs, &ast.Ident{Name: "_"})
+				}
+			}
+			errCheck.Init = &ast.AssignStmt{
+				Lhs: append(lhs, &ast.Ident{Name: t.errVarOf(fn, tryX)}),
+				Tok: tok,
+				Rhs: []ast.Expr{tryX.X},
+			}
+
+			// Leading comments stay before the if, and a trailing comment
+			// follows its opening brace.
+			errCheck.If = s.Pos()
+			setPos(errCheck.Init, s.Pos())
+			setPos(errCheck.Cond, checkPos(tryX))
+			if tryX.Handler == nil {
+				setPos(errCheck.Body, lineEnd(t.fset, tryX.End()))
+				errCheck.Body.Lbrace = tryX.End()
+			} else if end, ok := t.moveHandler(tryX); ok {
+				errCheck.Body.Lbrace = end
+			}
+			return nil, append(stmts, errCheck), nil
+		}
+		exprs = append(exprs, &s.X)
+	case *ast.AssignStmt:
+		// Index operands on the left are evaluated first.
+		for i := range s.Lhs {
+			exprs = append(exprs, assignedExprs(&s.Lhs[i])...)
+		}
+		for i := range s.Rhs {
+			exprs = append(exprs, &s.Rhs[i])
+		}
+	case *ast.IncDecStmt:
+		exprs = append(exprs, assignedExprs(&s.X)...)
+	case *ast.ReturnStmt:
+		if len(s.Results) == 1 {
+			if tryX, ok := s.Results[0].(*ast.TryExpr); ok && t.defaults[tryX] == nil {
+				return t.hoistReturn(fn, s, tryX, shadowed)
+			}
+		}
+		for i := range s.Results {
+			exprs = append(exprs, &s.Results[i])
+		}
+	case *ast.SendStmt:
+		exprs = append(exprs, &s.Chan, &s.Value)
+	case *ast.GoStmt:
+		exprs = append(exprs, callExprs(s.Call)...)
+	case *ast.DeferStmt:
+		exprs = append(exprs, callExprs(s.Call)...)
+	case *ast.DeclStmt:
+		if decl, ok := s.Decl.(*ast.GenDecl); ok && decl.Tok == token.VAR {
+			stmts, err := t.hoistVarDecl(fn, decl, shadowed)
+			if err != nil {
+				return nil, nil, err
+			}
+			return s, stmts, nil
+		}
+	}
+	stmts, err := t.hoistExprs(fn, shadowed, exprs...)
+	if err != nil {
+		return nil, nil, err
+	}
+	return s, stmts, nil
+}
+
+// hoistVarDecl hoists the try expressions of the values of decl. A try
+// expression declaring several variables, as in `var p, q = two()?`, is
+// assigned to a temporary for each of them, which become the values.
+func (t *transpiler) hoistVarDecl(fn *function, decl *ast.GenDecl, shadowed bool) ([]ast.Stmt, error) {
+	var stmts []ast.Stmt
+	var exprs []*ast.Expr
+	for _, spec := range decl.Specs {
+		spec := spec.(*ast.ValueSpec)
+		var rhs *ast.TryExpr
+		if len(spec.Names) > 1 && len(spec.Values) == 1 {
+			rhs, _ = spec.Values[0].(*ast.TryExpr)
+		}
+		if rhs == nil {
+			for i := range spec.Values {
+				exprs = append(exprs, &spec.Values[i])
+			}
+			continue
+		}
+
+		// The values of the specs before are evaluated first.
+		hoisted, err := t.hoistExprs(fn, shadowed, exprs...)
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, hoisted...)
+		for _, x := range exprs {
+			if hasSideEffects(*x) {
+				temp, assign := t.hoistValue(fn, *x)
+				*x = temp
+				stmts = append(stmts, assign)
+			}
+		}
+		exprs = nil
+
+		assign := &ast.AssignStmt{Tok: token.DEFINE, Rhs: []ast.Expr{rhs}}
+		base := baseName(rhs.X)
+		var values []ast.Expr
+		for range spec.Names {
+			temp := t.newName(fn, base)
+			assign.Lhs = append(assign.Lhs, &ast.Ident{Name: temp})
+			values = append(values, &ast.Ident{NamePos: rhs.Pos(), Name: temp})
+		}
+		setPos(assign, rhs.Pos())
+		before, after, err := t.lowerAssign(fn, assign, rhs, shadowed, fn.localScope(true))
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(append(append(stmts, before...), assign), after...)
+		spec.Values = values
+	}
+	hoisted, err := t.hoistExprs(fn, shadowed, exprs...)
+	if err != nil {
+		return nil, err
+	}
+	return append(stmts, hoisted...), nil
+}
+
+// hoistReturn lowers `return f()?`, which returns the values of f along
+// with a nil error. The values are stored in temporaries, one for each
+// result of fn but the error.
+func (t *transpiler) hoistReturn(fn *function, s *ast.ReturnStmt, tryX *ast.TryExpr, shadowed bool) (ast.Stmt, []ast.Stmt, error) {
+	errCheck, err := t.genErrCheck(fn, tryX, shadowed)
+	if err != nil {
+		return nil, nil, err
+	}
+	// The error result, if any, is nil.
+	var results []ast.Expr
+	n := fn.Type.Results.NumFields()
+	if t.hasErrResult(fn.Type) {
+		typ, err := t.errResultType(fn.Type)
+		if err != nil {
+			return nil, nil, t.errorf(tryX.Pos(), "%v", err)
+		}
+		results = []ast.Expr{t.genZeroValue(typ)}
+		n--
+	}
+	if n == 0 {
+		// Only the error is returned.
+		_, stmts, err := t.hoistStmt(fn, &ast.ExprStmt{X: tryX}, shadowed)
+		if err != nil {
+			return nil, nil, err
+		}
+		s.Results = results
+		for _, x := range s.Results {
+			setPos(x, tryX.Pos())
+		}
+		return s, stmts, nil
+	}
+
+	stmts, err := t.hoistExprs(fn, shadowed, &tryX.X)
+	if err != nil {
+		return nil, nil, err
+	}
+	base := baseName(tryX.X)
+	var lhs, temps []ast.Expr
+	for range n {
+		temp := t.newName(fn, base)
+		lhs = append(lhs, &ast.Ident{Name: temp})
+		temps = append(temps, &ast.Ident{Name: temp})
+	}
+	assign := &ast.AssignStmt{
+		Lhs: append(lhs, &ast.Ident{Name: t.errVarOf(fn, tryX)}),
+		Tok: token.DEFINE,
+		Rhs: []ast.Expr{tryX.X},
+	}
+	s.Results = append(temps, results...)
+
+	setPos(assign, tryX.Pos())
+	setPos(errCheck, checkPos(tryX))
+	for _, x := range s.Results {
+		setPos(x, tryX.End())
+	}
+	return s, append(stmts, assign, errCheck), nil
+}
+
+// hoistExprs hoists the try expressions in exprs in order. Expressions with
+// side effects before the last one with a try expression are stored in
+// temporaries, as hoistTryExprs does for operands.
+func (t *transpiler) hoistExprs(fn *function, shadowed bool, exprs ...*ast.Expr) ([]ast.Stmt, error) {
+	last := -1
+	for i, x := range exprs {
+		if containsTryExpr(*x) {
+			last = i
+		}
+	}
+	var stmts []ast.Stmt
+	for i, x := range exprs[:last+1] {
+		if containsTryExpr(*x) {
+			newX, hoisted, err := t.hoistTryExprs(fn, *x, shadowed)
+			if err != nil {
+				return nil, err
+			}
+			*x = newX
+			stmts = append(stmts, hoisted...)
+		}
+		if i < last && hasSideEffects(*x) {
+			temp, assign := t.hoistValue(fn, *x)
+			*x = temp
+			stmts = append(stmts, assign)
+		}
+	}
+	return stmts, nil
+}
+
+// assignedExprs returns the operands of x, which is assigned to, that are
+// evaluated as values, as the index of a map element. x itself is returned
+// if it is not a variable, a field, an element or an indirection.
+func assignedExprs(x *ast.Expr) []*ast.Expr {
+	switch lhs := (*x).(type) {
+	case *ast.Ident:
+		return nil
 	case *ast.ParenExpr:
-		return &ast.ParenExpr{X: replaceTryExpr(v.X, oldExpr, varName)}
-	case *ast.UnaryExpr:
-		return &ast.UnaryExpr{Op: v.Op, X: replaceTryExpr(v.X, oldExpr, varName)}
-	case *ast.CallExpr:
-		fun := replaceTryExpr(v.Fun, oldExpr, varName)
-		args := make([]ast.Expr, len(v.Args))
-		for i, arg := range v.Args {
-			args[i] = replaceTryExpr(arg, oldExpr, varName)
-		}
-		return &ast.CallExpr{Fun: fun, Args: args}
-	}
-	return expr
+		return assignedExprs(&lhs.X)
+	case *ast.SelectorExpr:
+		return assignedExprs(&lhs.X)
+	case *ast.IndexExpr:
+		return append(assignedExprs(&lhs.X), &lhs.Index)
+	case *ast.StarExpr:
+		return []*ast.Expr{&lhs.X}
+	}
+	return []*ast.Expr{x}
+}
+
+// callExprs returns the function and the arguments of call, which are
+// evaluated where a go or defer statement is executed.
+func callExprs(call *ast.CallExpr) []*ast.Expr {
+	exprs := []*ast.Expr{&call.Fun}
+	for i := range call.Args {
+		exprs = append(exprs, &call.Args[i])
+	}
+	return exprs
+}
+
+// negate returns the negation of the boolean expression x.
+func negate(x ast.Expr) ast.Expr {
+	switch x.(type) {
+	case *ast.Ident, *ast.CallExpr, *ast.SelectorExpr, *ast.IndexExpr, *ast.ParenExpr:
+	default:
+		x = &ast.ParenExpr{X: x}
+	}
+	return &ast.UnaryExpr{Op: token.NOT, X: x}
+}
+
+// findContinues returns the continue statements in body that continue the
+// loop with the given label, or the innermost loop if label is nil.
+func findContinues(body *ast.BlockStmt, label *ast.Ident) []*ast.BranchStmt {
+	var found []*ast.BranchStmt
+	var find func(n ast.Node, nested bool)
+	find = func(n ast.Node, nested bool) {
+		ast.Inspect(n, func(n ast.Node) bool {
+			switch x := n.(type) {
+			case *ast.FuncLit:
+				return false
+			case *ast.ForStmt:
+				find(x.Body, true)
+				return false
+			case *ast.RangeStmt:
+				find(x.Body, true)
+				return false
+			case *ast.BranchStmt:
+				if x.Tok != token.CONTINUE {
+					break
+				}
+				if x.Label == nil && !nested || x.Label != nil && label != nil && x.Label.Name == label.Name {
+					found = append(found, x)
+				}
+			}
+			return true
+		})
+	}
+	find(body, false)
+	return found
+}
+
+func getReaderFileName(reader io.Reader) string {
+	filename := "*unknown*"
+	if f, ok := reader.(interface{ Name() string }); ok {
+		filename = f.Name()
+	}
+	return filename
+}
+
+// Options configures the transpilation of a file.
+type Options struct {
+	// TypeCheck type-checks the package of the file before transpiling it,
+	// see typeCheck. Try expressions may then discard values other than
+	// the error, and errors of imported types are supported.
+	TypeCheck bool
+	// Fallback chooses how try expressions are lowered in functions
+	// without an error result. It defaults to FallbackNone, and a file may
+	// choose another with a comment like
+	//
+	//	//ego:fallback fatal
+	Fallback Fallback
+	// FatalHandler is the function main calls with the error instead of
+	// log.Fatal with FallbackFatal, as in "exit" or "cli.Exit".
+	FatalHandler string
+	// Annotate wraps the errors propagated by try expressions with the
+	// name of the enclosing function and the position of the expression,
+	// as in fmt.Errorf("loadConfig (config.ego:42): %w", err).
+	Annotate bool
+	// Hook is the function called with the error, the name of the
+	// enclosing function and the position of the try expression before an
+	// error is propagated, as in "github.com/acme/errtrace.Record" for
+	//
+	//	errtrace.Record(err, "main.loadConfig", "config.ego:42")
+	//
+	// The package is imported as needed. A name prefix, as in
+	// "trace=github.com/acme/errtrace/v2.Record", names the package when
+	// its name is not the last element of its path, and a function of the
+	// package of the file has no path.
+	Hook string
+	// DeferFirstError makes `defer?` statements return the error of the
+	// deferred call only when the function succeeds otherwise, rather than
+	// joining it with the error the function returns.
+	DeferFirstError bool
+	// CommaOkError is the function making the error of a try expression
+	// of a map index, a type assertion or a receive whose ok value is
+	// false, with the signature of fmt.Errorf, as in
+	// "github.com/acme/errs.Errorf". It is named like Hook, and defaults to
+	// fmt.Errorf and errors.New.
+	CommaOkError string
+}
+
+// Transpile transpiles the .ego source read from input into Go source
+// written to output.
+func Transpile(input io.Reader, output io.Writer) error {
+	return TranspileWithOptions(input, output, Options{})
+}
+
+// TranspileWithOptions is like Transpile, configured by opts.
+func TranspileWithOptions(input io.Reader, output io.Writer, opts Options) error {
+	filename := getReaderFileName(input)
+	src, err := io.ReadAll(input)
+	if err != nil {
+		return err
+	}
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, filename, src, parser.ParseComments)
+	if err != nil {
+		return err
+	}
+
+	// ast.Print(fset, file)
+
+	t := &transpiler{fset: fset, file: file, annotations: opts.Annotate, deferFirstError: opts.DeferFirstError}
+	if err := t.setFallback(opts); err != nil {
+		return err
+	}
+	if t.hook, err = t.funcOption("hook", opts.Hook); err != nil {
+		return err
+	}
+	if t.okError, err = t.funcOption("comma-ok error", opts.CommaOkError); err != nil {
+		return err
+	}
+	if opts.TypeCheck {
+		if err := t.typeCheck(filename); err != nil {
+			return err
+		}
+	}
+	t.lowerMustExprs()
+	t.lowerDefaultExprs()
+	if err := t.bindHandlers(); err != nil {
+		return err
+	}
+	if err := t.checkBranches(); err != nil {
+		return err
+	}
+	if err := t.nameErrResults(); err != nil {
+		return err
+	}
+	var transpileError error
+
+	astutil.Apply(file, t.preVisit, func(c *astutil.Cursor) bool {
+		if err := t.postVisit(c); err != nil {
+			transpileError = err
+			return false
+		}
+		return true
+	})
+
+	if transpileError != nil {
+		return transpileError
+	}
+	if tryX := findTryExpr(file); tryX != nil {
+		return t.errorf(tryX.Pos(), "%s is not supported here", t.exprKind(tryX))
+	}
+
+	t.mergeLines()
+	t.addImports()
+	t.addFuncImport(t.hook)
+	t.addFuncImport(t.okError)
+	t.layoutHandlers()
+
+	return format.Node(output, fset, file)
+}
+
+func (t *transpiler) postVisit(c *astutil.Cursor) error {
+	n := c.Node()
+	switch x := n.(type) {
+	case *ast.FuncDecl, *ast.FuncLit:
+		// Pop the function stack.
+		t.fstack.Pop()
+	case *ast.AssignStmt:
+		if c.Index() < 0 || !containsTryExpr(x) {
+			// Statements outside of statement lists are handled with
+			// the statement containing them.
+			break
+		}
+		enclosingFunc, err := t.enterStmt(c, false)
+		if err != nil {
+			return err
+		}
+
+		// Handle err := f()?
+		rhs := tryAssign(x)
+		if rhs == nil {
+			return t.hoistStmtAt(c, enclosingFunc, x)
+		}
+
+		// Outside of the function's outermost block, a named error result
+		// may be shadowed by an error variable declared with :=.
+		before, after, err := t.lowerAssign(enclosingFunc, x, rhs, c.Parent() != enclosingFunc.Body, enclosingFunc.localScope(false))
+		if err != nil {
+			return err
+		}
+		for _, stmt := range before {
+			c.InsertBefore(stmt)
+		}
+		for _, stmt := range slices.Backward(after) {
+			c.InsertAfter(stmt)
+		}
+	case *ast.ExprStmt, *ast.IncDecStmt, *ast.SendStmt, *ast.GoStmt, *ast.DeferStmt, *ast.DeclStmt, *ast.ReturnStmt:
+		if s, ok := x.(*ast.DeferStmt); ok && s.Question.IsValid() {
+			return t.lowerDeferAt(c, s)
+		}
+		if c.Index() < 0 || !containsTryExpr(x) {
+			break
+		}
+		// The error of a discarded value is scoped to its check.
+		tryX, ok := x.(*ast.ExprStmt)
+		scoped := ok && isTryExpr(tryX.X) && !containsTryExpr(tryX.X.(*ast.TryExpr).X)
+		enclosingFunc, err := t.enterStmt(c, scoped)
+		if err != nil {
+			return err
+		}
+		return t.hoistStmtAt(c, enclosingFunc, x.(ast.Stmt))
+	case *ast.IfStmt:
+		if c.Name() == "Else" {
+			// Handled with the first if statement of the chain.
+			break
+		}
+		return t.rewriteIfStmt(c, x)
+	case *ast.RangeStmt, *ast.ForStmt:
+		if _, ok := c.Parent().(*ast.LabeledStmt); ok {
+			// Handled with the labeled statement.
+			break
+		}
+		return t.rewriteLoopStmt(c, x.(ast.Stmt), nil)
+	case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+		if _, ok := c.Parent().(*ast.LabeledStmt); ok {
+			break
+		}
+		return t.rewriteSwitchStmt(c, x.(ast.Stmt))
+	case *ast.LabeledStmt:
+		switch x.Stmt.(type) {
+		case *ast.RangeStmt, *ast.ForStmt:
+			return t.rewriteLoopStmt(c, x.Stmt, x.Label)
+		case *ast.SwitchStmt, *ast.TypeSwitchStmt:
+			return t.rewriteSwitchStmt(c, x.Stmt)
+		}
+	}
+
+	return nil
+}
+
+// tryAssign returns the try expression assigned by x, as in `v := f()?`, or
+// nil if x is not such an assignment.
+func tryAssign(x *ast.AssignStmt) *ast.TryExpr {
+	if len(x.Rhs) > 1 || x.Tok != token.DEFINE && x.Tok != token.ASSIGN {
+		return nil
+	}
+	rhs, _ := x.Rhs[0].(*ast.TryExpr)
+	return rhs
+}
+
+// lowerAssign lowers x, which assigns the try expression rhs, to assign the
+// error along with the values. It returns the statements hoisted from the
+// operands of x and the statements following x, starting with the error
+// check. Variables declared by x are declared in local.
+func (t *transpiler) lowerAssign(fn *function, x *ast.AssignStmt, rhs *ast.TryExpr, shadowed bool, local *ast.Scope) ([]ast.Stmt, []ast.Stmt, error) {
+	if t.defaults[rhs] != nil && len(x.Lhs) != 1 {
+		return nil, nil, t.errorf(x.Pos(), "default expression assigned to %d variables, want 1", len(x.Lhs))
+	}
+	if t.isCommaOk(rhs) && len(x.Lhs) != 1 {
+		return nil, nil, t.errorf(x.Pos(), "comma-ok try expression assigned to %d variables, want 1", len(x.Lhs))
+	}
+	exprs := []*ast.Expr{}
+	for i := range x.Lhs {
+		exprs = append(exprs, assignedExprs(&x.Lhs[i])...)
+	}
+	before, err := t.hoistExprs(fn, shadowed, append(exprs, &rhs.X)...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Fields, elements and indirections are only stored once the error is
+	// checked, so they are left alone on failure. Their operands are still
+	// evaluated first.
+	var stores []ast.Stmt
+	if x.Tok == token.ASSIGN && !allIdents(x.Lhs) {
+		for _, op := range exprs {
+			if hasSideEffects(*op) {
+				temp, assign := t.hoistValue(fn, *op)
+				*op = temp
+				before = append(before, assign)
+			}
+		}
+		base := baseName(rhs.X)
+		for i, lhs := range x.Lhs {
+			if ident, ok := lhs.(*ast.Ident); ok && ident.Name == "_" {
+				continue
+			}
+			temp := t.newName(fn, base)
+			x.Lhs[i] = &ast.Ident{NamePos: lhs.Pos(), Name: temp}
+			stores = append(stores, &ast.AssignStmt{
+				Lhs: []ast.Expr{lhs},
+				Tok: token.ASSIGN,
+				Rhs: []ast.Expr{&ast.Ident{Name: temp}},
+			})
+		}
+		x.Tok = token.DEFINE
+	}
+	t.setDefault(rhs, x.Lhs[0])
+	for _, s := range before {
+		(&siteWalker{}).stmt(local, s)
+	}
+
+	// The error variable is assigned if it is declared already. Otherwise
+	// it is declared along with the assigned variables when they belong to
+	// the same block, and on its own before.
+	errVar := t.errVarOf(fn, rhs)
+	errVisible, _ := lookup(local, errVar)
+	switch {
+	case x.Tok == token.DEFINE && allBlank(x.Lhs) && errVisible != nil:
+		x.Tok = token.ASSIGN
+	case x.Tok == token.ASSIGN && errVisible == nil:
+		if declaredIn(local, x.Lhs) {
+			x.Tok = token.DEFINE
+			break
+		}
+		// A nil error of a concrete type must not become a non-nil
+		// error interface.
+		var errType ast.Expr = &ast.Ident{Name: "error"}
+		if t.isCommaOk(rhs) {
+			errType = &ast.Ident{Name: "bool"}
+		} else if typ := t.calleeErrType(rhs); typ != nil {
+			errType = cloneNode(typ)
+		}
+		decl := &ast.DeclStmt{
+			Decl: &ast.GenDecl{
+				Tok: token.VAR,
+				Specs: []ast.Spec{
+					&ast.ValueSpec{
+						Names: []*ast.Ident{{Name: errVar}},
+						Type:  errType,
+					},
+				},
+			},
+		}
+		setPos(decl, x.Pos())
+		before = append(before, decl)
+		if ident, ok := errType.(*ast.Ident); ok && ident.Name == "error" {
+			if t.errDecls == nil {
+				t.errDecls = make(map[*ast.DeclStmt]string)
+			}
+			t.errDecls[decl] = errVar
+		}
+	}
+
+	errCheck, err := t.genErrCheck(fn, rhs, shadowed)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	x.Rhs[0] = rhs.X
+	x.Lhs = append(x.Lhs, &ast.Ident{NamePos: x.TokPos, Name: errVar})
+
+	// Keep a trailing comment on the assignment's line.
+	t.moveHandler(rhs)
+	if rhs.Handler != nil {
+		setPos(errCheck, checkPos(rhs))
+	} else {
+		setPos(errCheck, lineEnd(t.fset, rhs.End()))
+	}
+	for _, store := range stores {
+		setPos(store, errCheck.End())
+	}
+	return before, append([]ast.Stmt{errCheck}, stores...), nil
+}
+
+// allIdents reports whether exprs are identifiers.
+func allIdents(exprs []ast.Expr) bool {
+	for _, x := range exprs {
+		if _, ok := x.(*ast.Ident); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// declaredIn reports whether exprs are identifiers declared in scope or
+// blank, so that := assigns them.
+func declaredIn(scope *ast.Scope, exprs []ast.Expr) bool {
+	for _, x := range exprs {
+		ident, ok := x.(*ast.Ident)
+		if !ok || ident.Name != "_" && scope.Lookup(ident.Name) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// enterStmt returns the function enclosing the statement at c, and chooses
+// the error variable of the statement. The error variable is scoped to the
+// statement if scoped is set.
+func (t *transpiler) enterStmt(c *astutil.Cursor, scoped bool) (*function, error) {
+	fn, err := t.getEnclosingFunc()
+	if err != nil {
+		return nil, t.errorf(c.Node().Pos(), "%v", err)
+	}
+	fn.site = findSite(fn, c.Node().(ast.Stmt))
+	fn.errVar = t.errVarAt(fn, fn.site, scoped)
+	fn.okVar = ""
+	if t.containsCommaOk(c.Node()) {
+		fn.okVar = t.okVarAt(fn, fn.site, scoped)
+	}
+	return fn, nil
+}
+
+// isTryExpr reports whether x is a try expression.
+func isTryExpr(x ast.Expr) bool {
+	_, ok := x.(*ast.TryExpr)
+	return ok
+}
+
+// hoistStmtAt hoists the try expressions of the statement at c in front of
+// it.
+func (t *transpiler) hoistStmtAt(c *astutil.Cursor, fn *function, stmt ast.Stmt) error {
+	stmt, before, err := t.hoistStmt(fn, stmt, c.Parent() != fn.Body)
+	if err != nil {
+		return err
+	}
+	for _, s := range before {
+		c.InsertBefore(s)
+	}
+	if stmt == nil {
+		c.Delete()
+	}
+	return nil
+}
+
+// lowerDeferAt lowers the `defer?` statement s at c, after hoisting the try
+// expressions of its call in front of it, and the values it evaluates.
+func (t *transpiler) lowerDeferAt(c *astutil.Cursor, s *ast.DeferStmt) error {
+	enclosingFunc, err := t.getEnclosingFunc()
+	if err != nil {
+		return t.errorf(s.Pos(), "%v", err)
+	}
+	// The error variable is only chosen for try expressions to hoist, so
+	// that no name is taken for nothing.
+	enclosingFunc.site = findSite(enclosingFunc, s)
+	if containsTryExpr(s) {
+		if _, err := t.enterStmt(c, false); err != nil {
+			return err
+		}
+		if err := t.hoistStmtAt(c, enclosingFunc, s); err != nil {
+			return err
+		}
+	}
+	base := strings.TrimSuffix(baseName(s.Call), "Res")
+	for _, stmt := range t.captureCall(enclosingFunc, s.Call) {
+		c.InsertBefore(stmt)
+	}
+	stmt, err := t.lowerDefer(enclosingFunc, s, base)
+	if err != nil {
+		return err
+	}
+	c.Replace(stmt)
+	return nil
+}
+
+// rewriteLoopStmt rewrites the loop at c, which is the loop itself or the
+// statement labeling it.
+func (t *transpiler) rewriteLoopStmt(c *astutil.Cursor, loop ast.Stmt, label *ast.Ident) error {
+	if !containsTryExpr(c.Node()) {
+		return nil
+	}
+	enclosingFunc, err := t.enterStmt(c, false)
+	if err != nil {
+		return err
+	}
+	before, err := t.rewriteLoop(enclosingFunc, loop, label, c.Parent() != enclosingFunc.Body)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range before {
+		c.InsertBefore(stmt)
+	}
+	return nil
+}
+
+// rewriteSwitchStmt rewrites the switch statement s at c, which is s itself
+// or the statement labeling it.
+func (t *transpiler) rewriteSwitchStmt(c *astutil.Cursor, s ast.Stmt) error {
+	if !containsTryExpr(c.Node()) {
+		return nil
+	}
+	enclosingFunc, err := t.enterStmt(c, false)
+	if err != nil {
+		return err
+	}
+	stmt := c.Node().(ast.Stmt)
+	newStmt, before, err := t.rewriteSwitch(enclosingFunc, s, stmt, c.Parent() != enclosingFunc.Body)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range before {
+		c.InsertBefore(stmt)
+	}
+	if newStmt != stmt {
+		c.Replace(newStmt)
+	}
+	return nil
+}
+
+// rewriteIfStmt rewrites the chain of if statements starting with x at c.
+func (t *transpiler) rewriteIfStmt(c *astutil.Cursor, x *ast.IfStmt) error {
+	if !containsTryExpr(c.Node()) {
+		return nil
+	}
+	enclosingFunc, err := t.enterStmt(c, true)
+	if err != nil {
+		return err
+	}
+	stmt, before, err := t.rewriteIf(enclosingFunc, x, c.Index() >= 0)
+	if err != nil {
+		return err
+	}
+	for _, s := range before {
+		c.InsertBefore(s)
+	}
+	if stmt != x {
+		c.Replace(stmt)
+	}
+	return nil
+}
+
+// allBlank reports whether all exprs are the blank identifier.
+func allBlank(exprs []ast.Expr) bool {
+	for _, x := range exprs {
+		if ident, ok := x.(*ast.Ident); !ok || ident.Name != "_" {
+			return false
+		}
+	}
+	return true
+}
+
+// containsTryExpr checks if a node contains any TryExpr nodes
+func containsTryExpr(node ast.Node) bool {
+	return findTryExpr(node) != nil
+}
+
+// findTryExpr returns the first try expression in node, or nil.
+func findTryExpr(node ast.Node) *ast.TryExpr {
+	var found *ast.TryExpr
+	ast.Inspect(node, func(n ast.Node) bool {
+		if tryX, ok := n.(*ast.TryExpr); ok && found == nil {
+			found = tryX
+		}
+		return found == nil
+	})
+	return found
 }
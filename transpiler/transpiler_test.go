@@ -2,55 +2,1146 @@ package transpiler
 
 import (
 	"bytes"
+	"context"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/aisk/ego/internal/diff"
 )
 
 func TestTranspiler(t *testing.T) {
-	testdata := "testdata"
-	
-	entries, err := os.ReadDir(testdata)
-	if err != nil {
-		t.Fatalf("Failed to read testdata directory: %v", err)
-	}
-
-	for _, entry := range entries {
-		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".ego") {
-			egoFile := filepath.Join(testdata, entry.Name())
-			expectedFile := filepath.Join(testdata, strings.TrimSuffix(entry.Name(), ".ego")+"_expected.go")
-			
-			t.Run(entry.Name(), func(t *testing.T) {
-				// Read .ego file
-				egoContent, err := os.ReadFile(egoFile)
-				if err != nil {
-					t.Fatalf("Failed to read .ego file: %v", err)
-				}
-				
-				// Read expected output
-				expectedContent, err := os.ReadFile(expectedFile)
-				if err != nil {
-					t.Fatalf("Failed to read expected.go file: %v", err)
-				}
-				
-				// Transpile the .ego content
-				input := bytes.NewReader(egoContent)
-				var output bytes.Buffer
-				
-				err = Transpile(input, &output)
-				if err != nil {
-					t.Fatalf("Transpile failed: %v", err)
-				}
-				
-				// Compare with expected
-				if output.String() != string(expectedContent) {
-					diffOutput := diff.Diff(expectedFile, expectedContent, "transpiled", []byte(output.String()))
-					t.Errorf("Transpiled result does not match expected:\n%s", diffOutput)
-				}
-			})
-		}
-	}
-}
\ No newline at end of file
+	testGolden(t, filepath.Join("testdata", "*.ego"), Options{})
+}
+
+// testGolden transpiles the .ego files matching pattern with opts, and
+// compares the results with the expected files: X_expected.go for X.ego in
+// testdata, and D_expected.go for a file of the directory D of testdata, so
+// that the expected files are not part of the package in D.
+func testGolden(t *testing.T, pattern string, opts Options) {
+	t.Helper()
+	egoFiles, err := filepath.Glob(pattern)
+	if err != nil {
+		t.Fatalf("Failed to match %s: %v", pattern, err)
+	}
+	if len(egoFiles) == 0 {
+		t.Fatalf("No .ego files match %s", pattern)
+	}
+
+	for _, egoFile := range egoFiles {
+		name := strings.TrimSuffix(egoFile, ".ego")
+		if dir := filepath.Dir(egoFile); dir != "testdata" {
+			name = dir
+		}
+		expectedFile := name + "_expected.go"
+
+		t.Run(strings.TrimPrefix(filepath.ToSlash(egoFile), "testdata/"), func(t *testing.T) {
+			expectedContent, err := os.ReadFile(expectedFile)
+			if err != nil {
+				t.Fatalf("Failed to read expected.go file: %v", err)
+			}
+			// The file is read from disk, as annotations name it and
+			// type-checked mode checks its package.
+			input, err := os.Open(egoFile)
+			if err != nil {
+				t.Fatalf("Failed to open .ego file: %v", err)
+			}
+			defer input.Close()
+
+			var output bytes.Buffer
+			if err := TranspileWithOptions(input, &output, opts); err != nil {
+				t.Fatalf("Transpile failed: %v", err)
+			}
+			if output.String() != string(expectedContent) {
+				diffOutput := diff.Diff(expectedFile, expectedContent, "transpiled", output.Bytes())
+				t.Errorf("Transpiled result does not match expected:\n%s", diffOutput)
+			}
+		})
+	}
+}
+
+func TestTranspileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{
+			name: "select case",
+			src: `package main
+
+func f() error {
+	select {
+	case v := <-channel()?:
+		println(v)
+	}
+	return nil
+}`,
+			err: "5:14: try expression is not supported here",
+		},
+		{
+			name: "handler falling through",
+			src: `package main
+
+import "log"
+
+func f() error {
+	v := g() ? err {
+		if err != nil {
+			return err
+		}
+		log.Print(err)
+	}
+	println(v)
+	return nil
+}`,
+			err: "11:2: missing return at end of error handler",
+		},
+		{
+			name: "blank handler error",
+			src: `package main
+
+func f() {
+	g() ? _ {
+		panic("g")
+	}
+}`,
+			err: "4:8: cannot use _ as the error of a handler",
+		},
+		{
+			name: "unused default",
+			src: `package main
+
+func f() {
+	g() ?? 0
+}`,
+			err: "4:2: default expression is not used",
+		},
+		{
+			name: "default assigned to two variables",
+			src: `package main
+
+func f() {
+	a, b := g() ?? 0
+	println(a, b)
+}`,
+			err: "4:2: default expression assigned to 2 variables, want 1",
+		},
+		{
+			name: "handle falling through",
+			src: `package main
+
+func f() error {
+	handle err {
+		println(err)
+	}
+	g()?
+	return nil
+}`,
+			err: "6:2: missing return at end of error handler",
+		},
+		{
+			name: "continue outside of a loop",
+			src: `package main
+
+func f() {
+	v := g()?continue
+	println(v)
+}`,
+			err: "4:11: ?continue is not in a loop",
+		},
+		{
+			name: "continue in a function literal in a loop",
+			src: `package main
+
+func f(xs []int) {
+	for range xs {
+		func() {
+			g()?continue
+		}()
+	}
+}`,
+			err: "6:8: ?continue is not in a loop",
+		},
+		{
+			name: "break in a switch",
+			src: `package main
+
+func f(xs []int) {
+	for _, x := range xs {
+		switch x {
+		case 0:
+			g()?break
+		}
+	}
+}`,
+			err: "7:8: unlabeled ?break in a switch or select statement",
+		},
+		{
+			name: "continue to a switch label",
+			src: `package main
+
+func f(xs []int) {
+	for _, x := range xs {
+	s:
+		switch x {
+		case 0:
+			g()?continue s
+		}
+	}
+}`,
+			err: "8:17: invalid ?continue label s",
+		},
+		{
+			name: "break to an unknown label",
+			src: `package main
+
+func f(xs []int) {
+	for range xs {
+		g()?break outer
+	}
+}`,
+			err: "5:13: invalid ?break label outer",
+		},
+		{
+			name: "labeled handle",
+			src: `package main
+
+func f() error {
+L:
+	handle err {
+		return err
+	}
+	g()?
+	return nil
+}`,
+			err: "5:2: misplaced handle statement",
+		},
+		{
+			name: "try after handle in select case",
+			src: `package main
+
+func f() error {
+	handle err {
+		return err
+	}
+	select {
+	case v := <-channel()?:
+		println(v)
+	}
+	return nil
+}`,
+			err: "8:14: try expression is not supported here",
+		},
+		{
+			name: "must in select case",
+			src: `package main
+
+func f() {
+	select {
+	case v := <-channel()!:
+		println(v)
+	}
+}`,
+			err: "5:14: must expression is not supported here",
+		},
+		{
+			name: "result not implementing error",
+			src: `package main
+
+func f() (int, string) {
+	return g()?, ""
+}`,
+			err: "4:9: try expression used in function whose last result string does not implement error",
+		},
+		{
+			name: "imported error type",
+			src: `package main
+
+import "example.com/errs"
+
+func f() errs.Coded {
+	g()?
+	return nil
+}`,
+			err: "6:2: cannot tell whether errs.Coded implements error without type information",
+		},
+		{
+			name: "wrapped concrete error",
+			src: `package main
+
+type MyError struct{}
+
+func (*MyError) Error() string { return "" }
+
+func f() *MyError {
+	g()?("g")
+	return nil
+}`,
+			err: "8:2: wrapped error cannot be returned as *MyError",
+		},
+		{
+			name: "mismatched concrete error",
+			src: `package main
+
+type MyError struct{}
+
+func (*MyError) Error() string { return "" }
+
+type OtherError struct{}
+
+func (OtherError) Error() string { return "" }
+
+func g() OtherError { return OtherError{} }
+
+func f() *MyError {
+	g()?
+	return nil
+}`,
+			err: "14:2: cannot return error of type OtherError as *MyError",
+		},
+		{
+			name: "concrete error of unknown type without fallback",
+			src: `package main
+
+type MyError struct{}
+
+func (*MyError) Error() string { return "" }
+
+func f() *MyError {
+	g()?
+	return nil
+}`,
+			err: "8:2: cannot return error of unknown type as *MyError without a fallback",
+		},
+		{
+			name: "defer? without error result",
+			src: `package main
+
+func f() {
+	defer? g()
+}`,
+			err: "4:7: defer? used in function that does not return an error",
+		},
+		{
+			name: "defer? with non-error last result",
+			src: `package main
+
+func f() (int, bool) {
+	defer? g()
+	return 0, false
+}`,
+			err: "4:7: defer? used in function whose last result bool is not error",
+		},
+		{
+			name: "defer? in function literal",
+			src: `package main
+
+func f() error {
+	func() {
+		defer? g()
+	}()
+	return nil
+}`,
+			err: "5:8: defer? used in function that does not return an error",
+		},
+		{
+			name: "defer? with shadowed error result",
+			src: `package main
+
+func f() (err error) {
+	if x, err := g(); err == nil {
+		defer? x.Close()
+	}
+	return nil
+}`,
+			err: "5:8: defer? cannot set the error result err, which is shadowed here",
+		},
+		{
+			name: "comma-ok try expression assigned to two variables",
+			src: `package main
+
+func f(m map[string]int) error {
+	v, ok := m["k"]?
+	return nil
+}`,
+			err: "4:2: comma-ok try expression assigned to 2 variables, want 1",
+		},
+		{
+			name: "comma-ok concrete error",
+			src: `package main
+
+type MyError struct{}
+
+func (*MyError) Error() string { return "" }
+
+func f(v any) *MyError {
+	v.(string)?
+	return nil
+}`,
+			err: "8:2: comma-ok error cannot be returned as *MyError",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var output bytes.Buffer
+			err := Transpile(strings.NewReader(test.src), &output)
+			if err == nil {
+				t.Fatalf("Transpile succeeded, want error containing %q", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Transpile error = %q, want error containing %q", err, test.err)
+			}
+		})
+	}
+}
+
+// TestTranspileContinuePost runs a loop skipping iterations with continue
+// and `?continue`, whose post statement has a try expression, to completion.
+func TestTranspileContinuePost(t *testing.T) {
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	src := `package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+func next(i int) (int, error) { return i + 1, nil }
+
+func sum(args []string) (int, error) {
+	n := 0
+	for i := 0; i < len(args); i = next(i)? {
+		if args[i] == "" {
+			continue
+		}
+		n += strconv.Atoi(args[i])?continue
+	}
+	return n, nil
+}
+
+func main() {
+	fmt.Println(sum([]string{"1", "x", "", "2", "y"}))
+}
+`
+	// The loop would not complete if continue skipped the post statement.
+	if got, want := transpileAndRun(t, goCmd, src), "3 <nil>\n"; got != want {
+		t.Errorf("go run printed %q, want %q", got, want)
+	}
+}
+
+func TestTranspileEvalOrder(t *testing.T) {
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	src := `package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+var calls []string
+
+func call(name string) int {
+	calls = append(calls, name)
+	return len(calls)
+}
+
+func try(name string) (int, error) { return call(name), nil }
+
+func use(xs ...int) int { return len(xs) }
+
+type pair struct{ a, b int }
+
+func run() error {
+	use(call("a"), try("b")?)
+	x := call("c") + try("d")?
+	y, z := call("e"), try("f")?
+	p := pair{a: call("g"), b: try("h")?}
+	m := map[int]int{}
+	m[call("i")] = try("j")?
+	use(use(call("k"), try("l")?), try("m")?)
+	use(x, y, z, p.a, len(m))
+	return nil
+}
+
+func main() {
+	run()
+	fmt.Println(strings.Join(calls, " "))
+}
+`
+	if got, want := transpileAndRun(t, goCmd, src), "a b c d e f g h i j k l m\n"; got != want {
+		t.Errorf("go run printed %q, want %q", got, want)
+	}
+}
+
+func TestTranspileAssignOnError(t *testing.T) {
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	src := `package main
+
+import (
+	"errors"
+	"fmt"
+)
+
+type pair struct{ a, b int }
+
+func fail() (int, error) { return 1, errors.New("failed") }
+
+func setElem(m map[string]int) error {
+	m["a"] = fail()?
+	return nil
+}
+
+func setField(p *pair) error {
+	p.a = fail()?
+	return nil
+}
+
+func setPointee(n *int) error {
+	*n = fail()?
+	return nil
+}
+
+func main() {
+	m := map[string]int{"a": 5}
+	p := pair{a: 7}
+	n := 9
+	fmt.Println(setElem(m), setField(&p), setPointee(&n), m["a"], p.a, n)
+}
+`
+	if got, want := transpileAndRun(t, goCmd, src), "failed failed failed 5 7 9\n"; got != want {
+		t.Errorf("go run printed %q, want %q", got, want)
+	}
+}
+
+func TestTranspileConcreteErrors(t *testing.T) {
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	src := `package main
+
+import "fmt"
+
+type MyErr struct{}
+
+func (*MyErr) Error() string { return "mine" }
+
+func mine() (int, *MyErr) { return 7, nil }
+
+func declared() (int, error) {
+	var err error
+	fmt.Print(err, " ")
+	n := mine()?
+	return n, nil
+}
+
+func named() (n int, err error) {
+	n = mine()?
+	return n, nil
+}
+
+func main() {
+	fmt.Println(declared())
+	fmt.Println(named())
+}
+`
+	// A nil *MyErr must not be returned as a non-nil error.
+	if got, want := transpileAndRun(t, goCmd, src), "<nil> 7 <nil>\n7 <nil>\n"; got != want {
+		t.Errorf("go run printed %q, want %q", got, want)
+	}
+}
+
+func TestTranspileDeferEvaluation(t *testing.T) {
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("go command not found")
+	}
+	src := `package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type closer struct{ name string }
+
+func (c *closer) Close() error { return errors.New(c.name) }
+
+func fail(name string, n int) error { return fmt.Errorf("%s %d", name, n) }
+
+func next() int {
+	fmt.Print("next ")
+	return 3
+}
+
+func run() error {
+	c := &closer{"first"}
+	defer? c.Close()
+	c = &closer{"second"}
+	n := 1
+	defer? fail("n", n)
+	n++
+	defer? fail("next", next())
+	defer? fail("parsed", strconv.Atoi("4")?)
+	fmt.Print("body ")
+	return nil
+}
+
+func main() {
+	fmt.Printf("%q\n", run())
+}
+`
+	// As with defer, the call is evaluated at the defer? statement.
+	if got, want := transpileAndRun(t, goCmd, src), "next body \"parsed 4\\nnext 3\\nn 1\\nfirst\"\n"; got != want {
+		t.Errorf("go run printed %q, want %q", got, want)
+	}
+}
+
+// transpileAndRun transpiles src and runs it with the go command goCmd,
+// returning its output.
+func transpileAndRun(t *testing.T, goCmd, src string) string {
+	t.Helper()
+	var output bytes.Buffer
+	if err := Transpile(strings.NewReader(src), &output); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	name := filepath.Join(t.TempDir(), "main.go")
+	if err := os.WriteFile(name, output.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	out, err := exec.CommandContext(ctx, goCmd, "run", name).CombinedOutput()
+	if err != nil {
+		t.Fatalf("go run failed: %v\n%s\n%s", err, out, output.Bytes())
+	}
+	return string(out)
+}
+
+func TestTranspileFallbackOptions(t *testing.T) {
+	src := `package main
+
+func main() {
+	f()?
+}
+`
+	opts := Options{Fallback: FallbackFatal, FatalHandler: "exit"}
+	var output bytes.Buffer
+	if err := TranspileWithOptions(strings.NewReader(src), &output, opts); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	want := `package main
+
+func main() {
+	if err := f(); err != nil {
+		exit(err)
+	}
+}
+`
+	if output.String() != want {
+		t.Errorf("Transpiled result does not match expected:\n%s", diff.Diff("expected", []byte(want), "transpiled", output.Bytes()))
+	}
+
+	// A file chooses its own fallback.
+	src = "//ego:fallback none\n" + src
+	err := TranspileWithOptions(strings.NewReader(src), &output, opts)
+	if err == nil || !strings.Contains(err.Error(), "does not return an error") {
+		t.Errorf("Transpile error = %v, want error for the missing error result", err)
+	}
+}
+
+func TestTranspileDeferFirstError(t *testing.T) {
+	src := `package main
+
+func save(path string) error {
+	f := create(path)?
+	defer? f.Close()
+	return write(f)
+}
+`
+	var output bytes.Buffer
+	if err := TranspileWithOptions(strings.NewReader(src), &output, Options{DeferFirstError: true}); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	want := `package main
+
+func save(path string) (err error) {
+	f, err := create(path)
+	if err != nil {
+		return
+	}
+	defer func() {
+		if closeErr := f.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}()
+	return write(f)
+}
+`
+	if output.String() != want {
+		t.Errorf("Transpiled result does not match expected:\n%s", diff.Diff("expected", []byte(want), "transpiled", output.Bytes()))
+	}
+}
+
+func TestTranspileHookOptions(t *testing.T) {
+	src := `package main
+
+import trace "example.com/errtrace/v2"
+
+var _ trace.Span
+
+func load() error {
+	f()?
+	return nil
+}
+`
+	opts := Options{Hook: "trace=example.com/errtrace/v2.Record"}
+	var output bytes.Buffer
+	if err := TranspileWithOptions(strings.NewReader(src), &output, opts); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	want := `package main
+
+import trace "example.com/errtrace/v2"
+
+var _ trace.Span
+
+func load() error {
+	if err := f(); err != nil {
+		trace.Record(err, "main.load", "*unknown*:8")
+		return err
+	}
+	return nil
+}
+`
+	if output.String() != want {
+		t.Errorf("Transpiled result does not match expected:\n%s", diff.Diff("expected", []byte(want), "transpiled", output.Bytes()))
+	}
+
+	// The package is imported as needed.
+	src = `package main
+
+func main() {
+	f()?
+}
+`
+	opts = Options{Fallback: FallbackPanic, Hook: "example.com/errtrace.Record"}
+	output.Reset()
+	if err := TranspileWithOptions(strings.NewReader(src), &output, opts); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	want = `package main
+
+import "example.com/errtrace"
+
+func main() {
+	if err := f(); err != nil {
+		errtrace.Record(err, "main.main", "*unknown*:4")
+		panic(err)
+	}
+}
+`
+	if output.String() != want {
+		t.Errorf("Transpiled result does not match expected:\n%s", diff.Diff("expected", []byte(want), "transpiled", output.Bytes()))
+	}
+
+	// A check calling the hook starts the chain of an if statement.
+	src = `package main
+
+func load() (int, error) {
+	if n := f()?; n > 0 {
+		return n, nil
+	}
+	return 0, nil
+}
+`
+	opts = Options{Hook: "example.com/errtrace.Record"}
+	output.Reset()
+	if err := TranspileWithOptions(strings.NewReader(src), &output, opts); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	want = `package main
+
+import "example.com/errtrace"
+
+func load() (int, error) {
+	if n, err := f(); err != nil {
+		errtrace.Record(err, "main.load", "*unknown*:4")
+		return 0, err
+	} else if n > 0 {
+		return n, nil
+	}
+	return 0, nil
+}
+`
+	if output.String() != want {
+		t.Errorf("Transpiled result does not match expected:\n%s", diff.Diff("expected", []byte(want), "transpiled", output.Bytes()))
+	}
+
+	// The hook is called before the handler of a handle statement, with
+	// the error before it is wrapped.
+	src = `package main
+
+func load(m map[string]string) (int, error) {
+	handle err {
+		return 0, err
+	}
+	s := m["n"]?
+	n := f(s)?("parsing %s", s)
+	return n, nil
+}
+`
+	output.Reset()
+	if err := TranspileWithOptions(strings.NewReader(src), &output, opts); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	want = `package main
+
+import (
+	"errors"
+	"example.com/errtrace"
+	"fmt"
+)
+
+func load(m map[string]string) (int, error) {
+	s, ok := m["n"]
+	if !ok {
+		err := errors.New("key \"n\" not found")
+		errtrace.Record(err, "main.load", "*unknown*:7")
+		return 0, err
+	}
+	n, err := f(s)
+	if err != nil {
+		errtrace.Record(err, "main.load", "*unknown*:8")
+		err = fmt.Errorf("parsing %s: %w", s, err)
+		return 0, err
+	}
+	return n, nil
+}
+`
+	if output.String() != want {
+		t.Errorf("Transpiled result does not match expected:\n%s", diff.Diff("expected", []byte(want), "transpiled", output.Bytes()))
+	}
+
+	for _, hook := range []string{"errtrace.", "gopkg.in/trace.v1.Record", "=Record"} {
+		err := TranspileWithOptions(strings.NewReader(src), &output, Options{Hook: hook})
+		if err == nil || !strings.Contains(err.Error(), "invalid hook") {
+			t.Errorf("Transpile with hook %q: error = %v, want invalid hook", hook, err)
+		}
+	}
+}
+
+func TestTranspileCommaOkError(t *testing.T) {
+	src := `package main
+
+func load(m map[string]int, k string) (int, error) {
+	v := m[k]?
+	n := m["100%"]?
+	return v + n, nil
+}
+`
+	opts := Options{CommaOkError: "errs=example.com/errs/v2.Errorf"}
+	var output bytes.Buffer
+	if err := TranspileWithOptions(strings.NewReader(src), &output, opts); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	want := `package main
+
+import errs "example.com/errs/v2"
+
+func load(m map[string]int, k string) (int, error) {
+	v, ok := m[k]
+	if !ok {
+		return 0, errs.Errorf("key %q not found", k)
+	}
+	n, ok := m["100%"]
+	if !ok {
+		return 0, errs.Errorf("key \"100%%\" not found")
+	}
+	return v + n, nil
+}
+`
+	if output.String() != want {
+		t.Errorf("Transpiled result does not match expected:\n%s", diff.Diff("expected", []byte(want), "transpiled", output.Bytes()))
+	}
+
+	// The hook is called with the error returned.
+	opts = Options{Hook: "example.com/errtrace.Record"}
+	output.Reset()
+	if err := TranspileWithOptions(strings.NewReader(src), &output, opts); err != nil {
+		t.Fatalf("Transpile failed: %v", err)
+	}
+	want = `package main
+
+import (
+	"errors"
+	"example.com/errtrace"
+	"fmt"
+)
+
+func load(m map[string]int, k string) (int, error) {
+	v, ok := m[k]
+	if !ok {
+		err := fmt.Errorf("key %q not found", k)
+		errtrace.Record(err, "main.load", "*unknown*:4")
+		return 0, err
+	}
+	n, ok := m["100%"]
+	if !ok {
+		err := errors.New("key \"100%\" not found")
+		errtrace.Record(err, "main.load", "*unknown*:5")
+		return 0, err
+	}
+	return v + n, nil
+}
+`
+	if output.String() != want {
+		t.Errorf("Transpiled result does not match expected:\n%s", diff.Diff("expected", []byte(want), "transpiled", output.Bytes()))
+	}
+
+	err := TranspileWithOptions(strings.NewReader(src), &output, Options{CommaOkError: "errs."})
+	if err == nil || !strings.Contains(err.Error(), "invalid comma-ok error") {
+		t.Errorf("Transpile with comma-ok error %q: error = %v, want invalid comma-ok error", "errs.", err)
+	}
+}
+
+func TestTranspileAnnotate(t *testing.T) {
+	testGolden(t, filepath.Join("testdata", "annotate", "*.ego"), Options{Annotate: true})
+}
+
+func TestTranspileTypeCheck(t *testing.T) {
+	testGolden(t, filepath.Join("testdata", "typecheck", "*.ego"), Options{TypeCheck: true})
+}
+
+func TestTranspileTypeCheckTestFiles(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"main.ego": `package main
+
+func f() (int, error) {
+	return helper()?
+}
+`,
+		"main_test.ego": `package main
+
+func g() (int, error) {
+	return helper()?
+}
+`,
+		"helper_test.go": `package main
+
+func helper() (int, error) { return 1, nil }
+`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	transpile := func(name string) error {
+		input, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer input.Close()
+		var output bytes.Buffer
+		return TranspileWithOptions(input, &output, Options{TypeCheck: true})
+	}
+
+	// Test files see the declarations of the other test files.
+	if err := transpile("main_test.ego"); err != nil {
+		t.Errorf("Transpile of main_test.ego failed: %v", err)
+	}
+	// Other files do not.
+	err := transpile("main.ego")
+	if want := "main.ego:4:9: undefined: helper"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Transpile of main.ego error = %v, want error containing %q", err, want)
+	}
+}
+
+func TestTranspileTypeCheckOffline(t *testing.T) {
+	t.Setenv("GOPROXY", "https://proxy.golang.org")
+	dir := t.TempDir()
+	files := map[string]string{
+		"go.mod": `module example.com/app
+
+go 1.22
+
+require example.com/missing v1.0.0
+`,
+		"main.ego": `package main
+
+import "example.com/missing"
+
+func f() error {
+	missing.Run()?
+	return nil
+}
+`,
+	}
+	for name, src := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	input, err := os.Open(filepath.Join(dir, "main.ego"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer input.Close()
+
+	// Modules missing from the cache are not downloaded.
+	var output bytes.Buffer
+	err = TranspileWithOptions(input, &output, Options{TypeCheck: true})
+	if want := "module lookup disabled by GOPROXY=off"; err == nil || !strings.Contains(err.Error(), want) {
+		t.Errorf("Transpile error = %v, want error containing %q", err, want)
+	}
+	if proxy := os.Getenv("GOPROXY"); proxy != "https://proxy.golang.org" {
+		t.Errorf("GOPROXY = %q after Transpile, want it restored", proxy)
+	}
+}
+
+func TestTranspileTypeCheckErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		err  string
+	}{
+		{
+			name: "not an error",
+			src: `package main
+
+import "strconv"
+
+func f() error {
+	strconv.Itoa(1)?
+	return nil
+}`,
+			err: "main.ego:6:17: try expression applied to strconv.Itoa(1), whose last value of type string is not an error",
+		},
+		{
+			name: "assignment mismatch",
+			src: `package main
+
+func pair() (int, int, error) { return 1, 2, nil }
+
+func f() error {
+	v := pair()?
+	_ = v
+	return nil
+}`,
+			err: "main.ego:6:7: assignment mismatch: 1 variable but pair()? returns 2 values",
+		},
+		{
+			name: "must assignment mismatch",
+			src: `package main
+
+func pair() (int, int, error) { return 1, 2, nil }
+
+func f() {
+	v := pair()!
+	_ = v
+}`,
+			err: "main.ego:6:7: assignment mismatch: 1 variable but pair()! returns 2 values",
+		},
+		{
+			name: "no value",
+			src: `package main
+
+func g() {}
+
+func f() error {
+	g()?
+	return nil
+}`,
+			err: "main.ego:6:5: try expression applied to g(), which has no value",
+		},
+		{
+			name: "must no value",
+			src: `package main
+
+func g() {}
+
+func f() {
+	g()!
+}`,
+			err: "main.ego:6:5: must expression applied to g(), which has no value",
+		},
+		{
+			name: "comma-ok assignment mismatch",
+			src: `package main
+
+func f(m map[string]int) error {
+	v, ok := m["k"]?
+	_, _ = v, ok
+	return nil
+}`,
+			err: `main.ego:4:11: assignment mismatch: 2 variables but m["k"]? returns 1 value`,
+		},
+		{
+			name: "undefined",
+			src: `package main
+
+func f() error {
+	g(1)?
+	return nil
+}`,
+			err: "main.ego:4:2: undefined: g",
+		},
+		{
+			name: "declared in another file",
+			src: `package main
+
+func f() (string, error) {
+	return lookup("key")?
+}`,
+			err: "main.ego:4:9: undefined: lookup",
+		},
+		{
+			name: "redeclared",
+			src: `package main
+
+func f() {}
+
+func f() {}`,
+			err: "main.ego:5:6: f redeclared in this block\n\t",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			name := filepath.Join(t.TempDir(), "main.ego")
+			if err := os.WriteFile(name, []byte(test.src), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			input, err := os.Open(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer input.Close()
+
+			var output bytes.Buffer
+			err = TranspileWithOptions(input, &output, Options{TypeCheck: true})
+			if err == nil {
+				t.Fatalf("Transpile succeeded, want error containing %q", test.err)
+			}
+			if !strings.Contains(err.Error(), test.err) {
+				t.Errorf("Transpile error = %q, want error containing %q", err, test.err)
+			}
+		})
+	}
+}
@@ -0,0 +1,625 @@
+package transpiler
+
+import (
+	"bytes"
+	"fmt"
+	goast "go/ast"
+	"go/build"
+	"go/importer"
+	goparser "go/parser"
+	gotoken "go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/astconv"
+	"github.com/aisk/ego/parser"
+	"github.com/aisk/ego/token"
+)
+
+// go/types checks Go syntax trees, which .ego files convert to with
+// astconv, where a try expression `x?` becomes a call of astconv.TryFunc.
+// The call is checked as the call of a generic helper function taking the
+// values of x and returning all but its error, as in __ego_try1(x). The
+// helper depends on the number of values of x, which is only known once x
+// is checked, so the package is checked again until no more try expressions
+// become known. A comma-ok try expression, whose values are its value and
+// the ok value, is checked as a call of a helper returning its value.
+
+// tryHelper is the prefix of the names of the helper functions.
+const tryHelper = astconv.TryFunc
+
+// commaOkArity is the arity of comma-ok try expressions, which call the
+// helper function tryHelper+"Ok".
+const commaOkArity = -1
+
+// maxCheckRounds bounds the number of times a package is checked.
+const maxCheckRounds = 8
+
+// typeInfo holds the type information of the file being transpiled.
+type typeInfo struct {
+	// Values of the operands of try expressions, the error included, by
+	// the positions of their question marks.
+	tries map[token.Pos][]types.Type
+	// Types of the expressions of the file, by their positions.
+	exprs map[span]types.Type
+	// The package checked, and the names of the packages the file imports.
+	pkg     *types.Package
+	imports map[string]string
+}
+
+// span is the range of positions of a node.
+type span struct{ pos, end token.Pos }
+
+// typeCheck checks the package of the file being transpiled, named
+// filename. The package consists of the .ego files and the .go files in the
+// directory of the file, except for the .go files generated from .ego files.
+// Imports are resolved from the sources in GOROOT and the module cache,
+// without fetching anything.
+func (t *transpiler) typeCheck(filename string) error {
+	files := []*ast.File{t.file}
+	var goPaths []string
+
+	dir := filepath.Dir(filename)
+	entries, err := os.ReadDir(dir)
+	if err != nil || filename == "*unknown*" {
+		entries = nil
+	}
+	// Test files are checked along with the other test files of the
+	// package, as go test does.
+	test := strings.HasSuffix(filename, "_test.ego")
+	for _, entry := range entries {
+		name := entry.Name()
+		path := filepath.Join(dir, name)
+		if entry.IsDir() || path == filename || sameFile(path, filename) {
+			continue
+		}
+		if !test && (strings.HasSuffix(name, "_test.ego") || strings.HasSuffix(name, "_test.go")) {
+			continue
+		}
+		switch {
+		case strings.HasSuffix(name, ".ego"):
+			f, err := parser.ParseFile(t.fset, path, nil, 0)
+			if err != nil {
+				return err
+			}
+			if f.Name.Name == t.file.Name.Name {
+				files = append(files, f)
+			}
+		case strings.HasSuffix(name, ".go"):
+			if _, err := os.Stat(strings.TrimSuffix(path, ".go") + ".ego"); err == nil {
+				// Generated from an .ego file.
+				continue
+			}
+			if ok, err := build.Default.MatchFile(dir, name); err == nil && ok {
+				goPaths = append(goPaths, path)
+			}
+		}
+	}
+
+	// Positions of the .ego files are shared with the Go file set.
+	goFset := astconv.ToGoFileSet(t.fset)
+	var goFiles []*goast.File
+	for _, path := range goPaths {
+		f, err := goparser.ParseFile(goFset, path, nil, 0)
+		if err != nil {
+			return err
+		}
+		if f.Name.Name == t.file.Name.Name {
+			goFiles = append(goFiles, f)
+		}
+	}
+
+	arity := make(map[token.Pos]int)
+	var last *checkResult
+	for range maxCheckRounds {
+		res, err := check(goFset, &sourceImporter, t.file.Name.Name, files, goFiles, arity)
+		if err != nil {
+			return err
+		}
+		last = res
+		known := 0
+		for question, values := range res.tries {
+			if _, ok := arity[question]; ok || len(values) == 0 {
+				continue
+			}
+			if res.commaOk[question] {
+				arity[question] = commaOkArity
+				known++
+				continue
+			}
+			if !implementsError(values[len(values)-1]) {
+				continue
+			}
+			arity[question] = len(values) - 1
+			known++
+		}
+		if known == 0 {
+			break
+		}
+	}
+
+	// Misused try expressions are reported before the errors they cause.
+	var misused error
+	ast.Inspect(t.file, func(n ast.Node) bool {
+		x, pos, kind := checkedOperand(n)
+		if x == nil || misused != nil {
+			return misused == nil
+		}
+		values, ok := last.tries[pos]
+		switch {
+		case !ok || last.commaOk[pos]:
+		case len(values) == 0:
+			misused = t.errorf(pos, "%s applied to %s, which has no value", kind, typeString(x))
+		case !implementsError(values[len(values)-1]):
+			misused = t.errorf(pos, "%s applied to %s, whose last value of type %s is not an error",
+				kind, typeString(x), types.TypeString(values[len(values)-1], (*types.Package).Name))
+		}
+		return true
+	})
+	if misused != nil {
+		return misused
+	}
+	for i, err := range last.errs {
+		pos := token.Pos(err.Pos)
+		if err.Soft || strings.HasPrefix(err.Msg, "\t") || t.fset.File(pos) != t.fset.File(t.file.Pos()) {
+			continue
+		}
+		// Errors continuing err, as in "\tother declaration of main",
+		// follow it.
+		msg := t.restoreTries(last.goFile, err.Msg, err.Pos)
+		for _, cont := range last.errs[i+1:] {
+			if !strings.HasPrefix(cont.Msg, "\t") {
+				break
+			}
+			msg += fmt.Sprintf("\n\t%s: %s", t.fset.Position(token.Pos(cont.Pos)), strings.TrimPrefix(cont.Msg, "\t"))
+		}
+		return t.errorf(pos, "%s", msg)
+	}
+
+	t.types = &typeInfo{
+		tries:   last.tries,
+		exprs:   last.exprs,
+		pkg:     last.pkg,
+		imports: importNames(t.file),
+	}
+	return nil
+}
+
+// sourceImporter imports packages from their sources for every file checked,
+// so that each package is only loaded once.
+var sourceImporter lockedImporter
+
+// lockedImporter is an importer of packages from their sources that may be
+// used by several checks at once.
+type lockedImporter struct {
+	mu  sync.Mutex
+	imp types.ImporterFrom
+}
+
+func (l *lockedImporter) Import(path string) (*types.Package, error) {
+	return l.ImportFrom(path, "", 0)
+}
+
+func (l *lockedImporter) ImportFrom(path, dir string, mode types.ImportMode) (*types.Package, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.imp == nil {
+		// Positions of imported packages are not reported, so they have
+		// a file set of their own.
+		l.imp = importer.ForCompiler(gotoken.NewFileSet(), "source", nil).(types.ImporterFrom)
+	}
+	// Packages of modules are located by go list, which inherits the
+	// environment and would download the modules missing from the cache.
+	if proxy, ok := os.LookupEnv("GOPROXY"); ok {
+		defer os.Setenv("GOPROXY", proxy)
+	} else {
+		defer os.Unsetenv("GOPROXY")
+	}
+	os.Setenv("GOPROXY", "off")
+	return l.imp.ImportFrom(path, dir, mode)
+}
+
+// checkedOperand returns the operand of the try, must or default
+// expression n, the position of its operator and the kind of n, or a nil
+// operand if n is none of them.
+func checkedOperand(n ast.Node) (ast.Expr, token.Pos, string) {
+	switch n := n.(type) {
+	case *ast.TryExpr:
+		return n.X, n.Question, "try expression"
+	case *ast.MustExpr:
+		return n.X, n.Bang, "must expression"
+	case *ast.DefaultExpr:
+		return n.X, n.OpPos, "default expression"
+	}
+	return nil, token.NoPos, ""
+}
+
+// sameFile reports whether the paths a and b name the same file.
+func sameFile(a, b string) bool {
+	fa, err := os.Stat(a)
+	if err != nil {
+		return false
+	}
+	fb, err := os.Stat(b)
+	return err == nil && os.SameFile(fa, fb)
+}
+
+// checkResult is the result of checking the package once.
+type checkResult struct {
+	tries   map[token.Pos][]types.Type
+	commaOk map[token.Pos]bool  // comma-ok try expressions
+	exprs   map[span]types.Type // expressions of the first file
+	goFile  *goast.File         // the first file converted
+	pkg     *types.Package
+	errs    []types.Error
+}
+
+// check checks the .ego files along with the .go files. Try expressions
+// with a known number of values are checked as calls of the helper function
+// for that number.
+func check(fset *gotoken.FileSet, imp types.Importer, pkgName string, files []*ast.File, goFiles []*goast.File, arity map[token.Pos]int) (*checkResult, error) {
+	res := &checkResult{
+		tries:   make(map[token.Pos][]types.Type),
+		commaOk: make(map[token.Pos]bool),
+		exprs:   make(map[span]types.Type),
+	}
+	maxArity := 0
+	for _, n := range arity {
+		maxArity = max(maxArity, n)
+	}
+	helpers, err := goparser.ParseFile(fset, tryHelper+".go", helperSource(pkgName, maxArity), 0)
+	if err != nil {
+		return nil, err
+	}
+
+	all := append([]*goast.File{helpers}, goFiles...)
+	operands := make(map[token.Pos]goast.Expr)
+	returns := make(map[*goast.CallExpr]goast.Expr)
+	for i, f := range files {
+		gf := astconv.ToGo(f).(*goast.File)
+		goast.Inspect(gf, func(n goast.Node) bool {
+			switch n := n.(type) {
+			case *goast.FuncDecl:
+				tryReturns(n.Type, n.Body, returns)
+			case *goast.FuncLit:
+				tryReturns(n.Type, n.Body, returns)
+			case *goast.BlockStmt:
+				n.List = dropHandleStmts(n.List)
+			case *goast.CaseClause:
+				n.Body = dropHandleStmts(n.Body)
+			case *goast.CommClause:
+				n.Body = dropHandleStmts(n.Body)
+			case *goast.DeferStmt:
+				// A `defer?` statement defers its call.
+				if ident, ok := n.Call.Fun.(*goast.Ident); ok && ident.Name == astconv.DeferFunc && len(n.Call.Args) == 1 {
+					n.Call = n.Call.Args[0].(*goast.CallExpr)
+				}
+			}
+			call, ok := n.(*goast.CallExpr)
+			if !ok || !isTryCall(call) {
+				return true
+			}
+			// The arguments wrapping or handling the error and default
+			// values are not checked.
+			call.Args = call.Args[:1]
+			question := token.Pos(call.Lparen)
+			operands[question] = call.Args[0]
+			if n, ok := arity[question]; ok {
+				ident := call.Fun.(*goast.Ident)
+				typ, returned := returns[call]
+				switch {
+				case n == commaOkArity:
+					ident.Name = tryHelper + "Ok"
+				case returned && ident.Name == astconv.TryFunc:
+					// The error is returned as well.
+					ident.Name = fmt.Sprintf("%sRet%d", tryHelper, n)
+					call.Fun = &goast.IndexExpr{X: ident, Lbrack: ident.End(), Index: typ, Rbrack: ident.End()}
+				default:
+					ident.Name = fmt.Sprintf("%s%d", tryHelper, n)
+				}
+			}
+			return true
+		})
+		if i == 0 {
+			res.goFile = gf
+		}
+		all = append(all, gf)
+	}
+
+	info := &types.Info{Types: make(map[goast.Expr]types.TypeAndValue)}
+	conf := types.Config{
+		Importer: imp,
+		Error: func(err error) {
+			if err, ok := err.(types.Error); ok {
+				res.errs = append(res.errs, err)
+			}
+		},
+	}
+	res.pkg, _ = conf.Check(pkgName, fset, all, info)
+
+	for question, x := range operands {
+		tv, ok := info.Types[x]
+		if !ok || tv.Type == nil || tv.Type == types.Typ[types.Invalid] {
+			continue
+		}
+		if isCommaOkGo(x, info) {
+			res.tries[question] = []types.Type{tv.Type, types.Typ[types.Bool]}
+			res.commaOk[question] = true
+		} else if tuple, ok := tv.Type.(*types.Tuple); ok {
+			values := make([]types.Type, tuple.Len())
+			for i := range values {
+				values[i] = tuple.At(i).Type()
+			}
+			res.tries[question] = values
+		} else {
+			res.tries[question] = []types.Type{tv.Type}
+		}
+	}
+	goast.Inspect(res.goFile, func(n goast.Node) bool {
+		x, ok := n.(goast.Expr)
+		if !ok {
+			return true
+		}
+		if tv, ok := info.Types[x]; ok && tv.Type != nil && tv.Type != types.Typ[types.Invalid] {
+			res.exprs[span{token.Pos(x.Pos()), token.Pos(x.End())}] = tv.Type
+		}
+		return true
+	})
+	return res, nil
+}
+
+// isCommaOkGo reports whether the operand x of a try expression checks an
+// ok value, see isCommaOk.
+func isCommaOkGo(x goast.Expr, info *types.Info) bool {
+	switch x := goast.Unparen(x).(type) {
+	case *goast.TypeAssertExpr:
+		return x.Type != nil
+	case *goast.UnaryExpr:
+		return x.Op == gotoken.ARROW
+	case *goast.IndexExpr:
+		tv, ok := info.Types[x.X]
+		if !ok || tv.Type == nil {
+			return false
+		}
+		_, isMap := tv.Type.Underlying().(*types.Map)
+		return isMap
+	}
+	return false
+}
+
+// dropHandleStmts removes the statements converted from handle statements
+// from list. Their handlers return from the function declaring them, which
+// the function literals they convert to do not.
+func dropHandleStmts(list []goast.Stmt) []goast.Stmt {
+	return slices.DeleteFunc(list, func(s goast.Stmt) bool {
+		stmt, ok := s.(*goast.ExprStmt)
+		if !ok {
+			return false
+		}
+		call, ok := stmt.X.(*goast.CallExpr)
+		if !ok {
+			return false
+		}
+		ident, ok := call.Fun.(*goast.Ident)
+		return ok && ident.Name == astconv.HandleFunc
+	})
+}
+
+// tryReturns records in returns the type of the last result of the
+// function with type typ and body for the try calls its return statements
+// return, which return the values of the try and the error.
+func tryReturns(typ *goast.FuncType, body *goast.BlockStmt, returns map[*goast.CallExpr]goast.Expr) {
+	if body == nil || typ.Results == nil || len(typ.Results.List) == 0 {
+		return
+	}
+	last := typ.Results.List[len(typ.Results.List)-1].Type
+	goast.Inspect(body, func(n goast.Node) bool {
+		switch n := n.(type) {
+		case *goast.FuncLit:
+			return false
+		case *goast.ReturnStmt:
+			if len(n.Results) != 1 {
+				return true
+			}
+			if call, ok := n.Results[0].(*goast.CallExpr); ok && isTryCall(call) {
+				returns[call] = last
+			}
+		}
+		return true
+	})
+}
+
+// isTryCall reports whether call is the call of the helper function
+// converted from a try, must or default expression, which are checked
+// alike.
+func isTryCall(call *goast.CallExpr) bool {
+	ident, ok := call.Fun.(*goast.Ident)
+	if !ok || len(call.Args) == 0 || call.Lparen < call.Args[0].End() {
+		return false
+	}
+	switch ident.Name {
+	case astconv.TryFunc, astconv.MustFunc, astconv.DefaultFunc:
+		return true
+	}
+	return false
+}
+
+// helperSource returns the source of the helper functions for try
+// expressions with up to n values besides the error. Try expressions with
+// an unknown number of values call __ego_try, which takes any values, and
+// comma-ok try expressions call __ego_tryOk. Returned try expressions call
+// __ego_tryRet0 and so on, which return the error result of type R too.
+func helperSource(pkgName string, n int) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "package %s\n\n", pkgName)
+	fmt.Fprintf(&buf, "func %s(...any) {}\n", tryHelper)
+	fmt.Fprintf(&buf, "func %sOk[T any](v T) T { return v }\n", tryHelper)
+	for i := 0; i <= n; i++ {
+		var tparams, params, results, values []string
+		for j := range i {
+			tparams = append(tparams, fmt.Sprintf("T%d any", j))
+			params = append(params, fmt.Sprintf("v%d T%d", j, j))
+			results = append(results, fmt.Sprintf("T%d", j))
+			values = append(values, fmt.Sprintf("v%d", j))
+		}
+		tparams = append(tparams, "E error")
+		params = append(params, "_ E")
+		fmt.Fprintf(&buf, "func %s%d[%s](%s) (%s) { return %s }\n",
+			tryHelper, i, strings.Join(tparams, ", "), strings.Join(params, ", "),
+			strings.Join(results, ", "), strings.Join(values, ", "))
+		tparams = append([]string{"R any"}, tparams...)
+		results = append(results, "R")
+		values = append(values, "*new(R)")
+		fmt.Fprintf(&buf, "func %sRet%d[%s](%s) (%s) { return %s }\n",
+			tryHelper, i, strings.Join(tparams, ", "), strings.Join(params, ", "),
+			strings.Join(results, ", "), strings.Join(values, ", "))
+	}
+	return buf.Bytes()
+}
+
+// restoreTries replaces the calls of helper functions in msg, an error
+// message about file at pos, with the try, must and default expressions
+// they replace. A message about a call may name the function called only.
+func (t *transpiler) restoreTries(file *goast.File, msg string, pos gotoken.Pos) string {
+	ops := make(map[token.Pos]string)
+	ast.Inspect(t.file, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.MustExpr:
+			ops[n.Bang] = "!"
+		case *ast.DefaultExpr:
+			ops[n.OpPos] = " ?? " + typeString(n.Y)
+		}
+		return true
+	})
+	var calls []string
+	tries := make(map[string]string)
+	var name, try string
+	goast.Inspect(file, func(n goast.Node) bool {
+		call, ok := n.(*goast.CallExpr)
+		if !ok || len(call.Args) != 1 {
+			return true
+		}
+		fun := call.Fun
+		if index, ok := fun.(*goast.IndexExpr); ok {
+			fun = index.X
+		}
+		if ident, ok := fun.(*goast.Ident); ok && strings.HasPrefix(ident.Name, tryHelper) {
+			x := types.ExprString(call)
+			calls = append(calls, x)
+			op, ok := ops[token.Pos(call.Lparen)]
+			if !ok {
+				op = "?"
+			}
+			tries[x] = types.ExprString(call.Args[0]) + op
+			if call.Pos() == pos {
+				name, try = ident.Name, tries[x]
+			}
+		}
+		return true
+	})
+	// Calls are found before the calls they contain.
+	for _, x := range calls {
+		msg = strings.ReplaceAll(msg, x, tries[x])
+	}
+	if name != "" {
+		msg = strings.ReplaceAll(msg, name, try)
+	}
+	return msg
+}
+
+// errorType is the type of the predeclared error interface.
+var errorType = types.Universe.Lookup("error").Type().Underlying().(*types.Interface)
+
+// implementsError reports whether typ implements error.
+func implementsError(typ types.Type) bool {
+	return typ != types.Typ[types.Invalid] && types.Implements(typ, errorType)
+}
+
+// importNames maps the paths of the packages imported by file to the names
+// they are imported with, which are empty for the package names.
+func importNames(file *ast.File) map[string]string {
+	names := make(map[string]string)
+	for _, spec := range file.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		names[path] = ""
+		if spec.Name != nil {
+			names[path] = spec.Name.Name
+		}
+	}
+	return names
+}
+
+// typeOf returns the type of the expression x of the file, or nil if it
+// is not known.
+func (t *transpiler) typeOf(x ast.Expr) types.Type {
+	if t.types == nil || x == nil || !x.Pos().IsValid() {
+		return nil
+	}
+	return t.types.exprs[span{x.Pos(), x.End()}]
+}
+
+// tryValues returns the types of the values of the operand of x, the error
+// included, or nil if they are not known.
+func (t *transpiler) tryValues(x *ast.TryExpr) []types.Type {
+	if t.types == nil {
+		return nil
+	}
+	return t.types.tries[x.Question]
+}
+
+// typeExpr returns an expression of typ, or nil if typ refers to a package
+// the file does not import.
+func (t *transpiler) typeExpr(typ types.Type) ast.Expr {
+	ok := true
+	s := types.TypeString(typ, func(pkg *types.Package) string {
+		if pkg == t.types.pkg {
+			return ""
+		}
+		name, imported := t.types.imports[pkg.Path()]
+		switch {
+		case !imported || name == "_":
+			ok = false
+		case name == "":
+			return pkg.Name()
+		case name == ".":
+			return ""
+		}
+		return name
+	})
+	if !ok {
+		return nil
+	}
+	x, err := parser.ParseExpr(s)
+	if err != nil {
+		return nil
+	}
+	return x
+}
+
+// errKindOfGo determines the kind of the checked type typ.
+func errKindOfGo(typ types.Type) errKind {
+	switch {
+	case !implementsError(typ):
+		return notErrKind
+	case isTypeParam(typ):
+		return typeParamErrKind
+	case types.IsInterface(typ):
+		return ifaceErrKind
+	}
+	return concreteErrKind
+}
+
+// isTypeParam reports whether typ is a type parameter.
+func isTypeParam(typ types.Type) bool {
+	_, ok := types.Unalias(typ).(*types.TypeParam)
+	return ok
+}
@@ -0,0 +1,210 @@
+package transpiler
+
+import (
+	"go/types"
+	"reflect"
+
+	"github.com/aisk/ego/ast"
+	"github.com/aisk/ego/token"
+)
+
+// typeKind classifies a type by the form of its zero value.
+type typeKind int
+
+const (
+	unknownKind   typeKind = iota // zero value is *new(T)
+	numberKind                    // zero value is 0
+	stringKind                    // zero value is ""
+	boolKind                      // zero value is false
+	nilKind                       // zero value is nil
+	compositeKind                 // zero value is T{}
+)
+
+// kindOf determines the kind of the type expression typ. Types declared in
+// the file are followed to their definition, while imported types and type
+// parameters are reported as unknownKind.
+func kindOf(typ ast.Expr) typeKind {
+	return kindOfType(typ, make(map[*ast.TypeSpec]bool))
+}
+
+func kindOfType(typ ast.Expr, seen map[*ast.TypeSpec]bool) typeKind {
+	switch t := typ.(type) {
+	case *ast.Ident:
+		if t.Obj == nil {
+			return predeclaredKind(t.Name)
+		}
+		spec, ok := t.Obj.Decl.(*ast.TypeSpec)
+		if !ok || t.Obj.Kind != ast.Typ || seen[spec] {
+			// Type parameter, or an invalid recursive type.
+			return unknownKind
+		}
+		seen[spec] = true
+		return kindOfType(spec.Type, seen)
+	case *ast.ParenExpr:
+		return kindOfType(t.X, seen)
+	case *ast.IndexExpr:
+		// Instantiated generic type.
+		return kindOfType(t.X, seen)
+	case *ast.IndexListExpr:
+		return kindOfType(t.X, seen)
+	case *ast.StarExpr, *ast.MapType, *ast.ChanType, *ast.FuncType, *ast.InterfaceType:
+		return nilKind
+	case *ast.ArrayType:
+		if t.Len == nil {
+			// Slice type.
+			return nilKind
+		}
+		return compositeKind
+	case *ast.StructType:
+		return compositeKind
+	}
+	return unknownKind
+}
+
+func predeclaredKind(name string) typeKind {
+	switch name {
+	case "int", "int8", "int16", "int32", "int64",
+		"uint", "uint8", "uint16", "uint32", "uint64", "uintptr",
+		"float32", "float64", "complex64", "complex128", "byte", "rune":
+		return numberKind
+	case "string":
+		return stringKind
+	case "bool":
+		return boolKind
+	case "error", "any":
+		return nilKind
+	}
+	return unknownKind
+}
+
+// genZeroValue generates the zero value of the type expression typ. The
+// kind of a type unknown from the source is taken from the type information
+// of the file if it is type-checked.
+func (t *transpiler) genZeroValue(typ ast.Expr) ast.Expr {
+	kind := kindOf(typ)
+	if checked := t.typeOf(typ); kind == unknownKind && checked != nil {
+		kind = kindOfGo(checked)
+	}
+	switch kind {
+	case numberKind:
+		return &ast.BasicLit{Kind: token.INT, Value: "0"}
+	case stringKind:
+		return &ast.BasicLit{Kind: token.STRING, Value: `""`}
+	case boolKind:
+		return &ast.Ident{Name: "false"}
+	case nilKind:
+		return &ast.Ident{Name: "nil"}
+	case compositeKind:
+		return &ast.CompositeLit{Type: cloneNode(ast.Unparen(typ))}
+	}
+	return &ast.StarExpr{
+		X: &ast.CallExpr{
+			Fun:  &ast.Ident{Name: "new"},
+			Args: []ast.Expr{cloneNode(typ)},
+		},
+	}
+}
+
+// kindOfGo determines the kind of the checked type typ.
+func kindOfGo(typ types.Type) typeKind {
+	switch u := typ.Underlying().(type) {
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsNumeric != 0:
+			return numberKind
+		case u.Info()&types.IsString != 0:
+			return stringKind
+		case u.Info()&types.IsBoolean != 0:
+			return boolKind
+		case u.Kind() == types.UnsafePointer:
+			return nilKind
+		}
+	case *types.Pointer, *types.Slice, *types.Map, *types.Chan, *types.Signature:
+		return nilKind
+	case *types.Interface:
+		if !isTypeParam(typ) {
+			return nilKind
+		}
+	case *types.Array, *types.Struct:
+		return compositeKind
+	}
+	return unknownKind
+}
+
+var (
+	posType          = reflect.TypeOf(token.NoPos)
+	objectType       = reflect.TypeOf((*ast.Object)(nil))
+	scopeType        = reflect.TypeOf((*ast.Scope)(nil))
+	commentGroupType = reflect.TypeOf((*ast.CommentGroup)(nil))
+)
+
+// cloneNode returns a deep copy of n without positions, so that it can be
+// placed elsewhere in the file. Identifiers keep their resolved objects.
+func cloneNode[N ast.Node](n N) N {
+	return cloneValue(reflect.ValueOf(n), token.NoPos, nil).Interface().(N)
+}
+
+// cloneNodeAt is like cloneNode, but moves the positions of n to pos rather
+// than dropping them, which keeps optional tokens like an ellipsis.
+func cloneNodeAt[N ast.Node](n N, pos token.Pos) N {
+	return cloneValue(reflect.ValueOf(n), pos, nil).Interface().(N)
+}
+
+// cloneValue returns a deep copy of v with its positions moved to pos, and
+// records the positions moved in layout, if not nil.
+func cloneValue(v reflect.Value, pos token.Pos, layout map[*token.Pos]token.Pos) reflect.Value {
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() || v.Type() == objectType {
+			return v
+		}
+		if v.Type() == commentGroupType {
+			return reflect.Zero(v.Type())
+		}
+		c := reflect.New(v.Type().Elem())
+		if v.Elem().Kind() == reflect.Struct {
+			// Clone in place, so that the positions recorded stay put.
+			cloneStruct(c.Elem(), v.Elem(), pos, layout)
+		} else {
+			c.Elem().Set(cloneValue(v.Elem(), pos, layout))
+		}
+		return c
+	case reflect.Interface:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.New(v.Type()).Elem()
+		c.Set(cloneValue(v.Elem(), pos, layout))
+		return c
+	case reflect.Slice:
+		if v.IsNil() {
+			return v
+		}
+		c := reflect.MakeSlice(v.Type(), v.Len(), v.Len())
+		for i := range v.Len() {
+			c.Index(i).Set(cloneValue(v.Index(i), pos, layout))
+		}
+		return c
+	case reflect.Struct:
+		c := reflect.New(v.Type()).Elem()
+		cloneStruct(c, v, pos, layout)
+		return c
+	}
+	return v
+}
+
+// cloneStruct sets the fields of c, an addressable struct, to copies of the
+// fields of v, see cloneValue.
+func cloneStruct(c, v reflect.Value, pos token.Pos, layout map[*token.Pos]token.Pos) {
+	for i := range v.NumField() {
+		switch {
+		case v.Type().Field(i).Type != posType:
+			c.Field(i).Set(cloneValue(v.Field(i), pos, layout))
+		case pos.IsValid() && v.Field(i).Interface().(token.Pos).IsValid():
+			c.Field(i).Set(reflect.ValueOf(pos))
+			if layout != nil {
+				layout[c.Field(i).Addr().Interface().(*token.Pos)] = v.Field(i).Interface().(token.Pos)
+			}
+		}
+	}
+}